@@ -19,6 +19,7 @@ package gowarc
 import (
 	"errors"
 	"io"
+	"sync"
 
 	"github.com/nlnwa/gowarc/v2/internal/diskbuffer"
 )
@@ -136,3 +137,63 @@ func (block *genericBlock) Size() int64 {
 }
 
 var errContentReAccessed = errors.New("gowarc.Block: tried to access content twice")
+
+// bufferedBlock is a Block holding its content in a diskbuffer, which keeps small blocks in memory and spills larger
+// blocks to disk according to the buffer options of the record.
+//
+// It is embedded by blocks for formats which are parsed in full, e.g. DNS records.
+type bufferedBlock struct {
+	content     diskbuffer.Buffer
+	blockDigest *digest
+	digestOnce  sync.Once
+}
+
+func (block *bufferedBlock) IsCached() bool {
+	return true
+}
+
+func (block *bufferedBlock) Cache() error {
+	return nil
+}
+
+func (block *bufferedBlock) Close() error {
+	if block.content == nil {
+		return nil
+	}
+	return block.content.Close()
+}
+
+func (block *bufferedBlock) RawBytes() (io.Reader, error) {
+	return block.content.Slice(0, 0), nil
+}
+
+func (block *bufferedBlock) BlockDigest() string {
+	block.digestOnce.Do(func() {
+		_, _ = block.content.Slice(0, 0).WriteTo(block.blockDigest)
+	})
+	return block.blockDigest.format()
+}
+
+func (block *bufferedBlock) Size() int64 {
+	return block.content.Size()
+}
+
+// readContent buffers the content of a block. If r already is a buffer, e.g. the content of a record builder, it is
+// used as is. A read error is handled according to the SyntaxErrorPolicy.
+func (block *bufferedBlock) readContent(opts *warcRecordOptions, r io.Reader, validation *Validation) error {
+	if b, ok := r.(diskbuffer.Buffer); ok {
+		block.content = b
+		return nil
+	}
+	block.content = diskbuffer.New(opts.bufferOptions...)
+	_, err := block.content.ReadFrom(r)
+	if err != nil && opts.errSyntax > ErrIgnore {
+		switch opts.errSyntax {
+		case ErrWarn:
+			validation.addError(err)
+		case ErrFail:
+			return err
+		}
+	}
+	return nil
+}
@@ -17,10 +17,15 @@
 package gowarc
 
 import (
+	"bufio"
 	"io"
+	"net"
+	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/nlnwa/gowarc/v2/internal/diskbuffer"
 	"github.com/stretchr/testify/assert"
@@ -778,3 +783,153 @@ func (r *replaceErrReader) Read(p []byte) (int, error) {
 	}
 	return i, e
 }
+
+func Test_dnsBlock(t *testing.T) {
+	content := "20060102150405\r\n" +
+		"example.com.\t3600\tIN\tA\t93.184.216.34\r\n" +
+		"example.com.\t3600\tIN\tAAAA\t2606:2800:220:1:248:1893:25c8:1946\r\n" +
+		"example.com.\t3600\tIN\tMX\t10 mail.example.com.\r\n"
+
+	d, err := newDigest("sha1", Base16)
+	require.NoError(t, err)
+	validation := &Validation{}
+	block, err := newDnsBlock(&warcRecordOptions{errBlock: ErrWarn}, strings.NewReader(content), d, validation)
+	require.NoError(t, err)
+	assert.True(t, validation.Valid(), validation.String())
+
+	assert.Equal(t, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), block.FetchTime())
+	assert.Equal(t, []DnsResourceRecord{
+		{Name: "example.com.", TTL: 3600, Class: "IN", Type: "A", Data: "93.184.216.34"},
+		{Name: "example.com.", TTL: 3600, Class: "IN", Type: "AAAA", Data: "2606:2800:220:1:248:1893:25c8:1946"},
+		{Name: "example.com.", TTL: 3600, Class: "IN", Type: "MX", Data: "10 mail.example.com."},
+	}, block.ResourceRecords())
+	assert.Equal(t, []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("2606:2800:220:1:248:1893:25c8:1946")}, block.IPAddresses())
+	assert.Equal(t, int64(len(content)), block.Size())
+
+	r, err := block.RawBytes()
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(b))
+}
+
+func Test_dnsBlock_invalid(t *testing.T) {
+	content := "not a timestamp\nexample.com. IN A\n"
+
+	d, err := newDigest("sha1", Base16)
+	require.NoError(t, err)
+	validation := &Validation{}
+	block, err := newDnsBlock(&warcRecordOptions{errBlock: ErrWarn}, strings.NewReader(content), d, validation)
+	require.NoError(t, err)
+	assert.Len(t, *validation, 2)
+	assert.Empty(t, block.ResourceRecords())
+
+	_, err = newDnsBlock(&warcRecordOptions{errBlock: ErrFail}, strings.NewReader(content), d, &Validation{})
+	assert.EqualError(t, err, "gowarc: error in dns block at line 1: invalid dns fetch time: 'not a timestamp'")
+}
+
+func Test_ftpControlBlock(t *testing.T) {
+	content := "220-Welcome\r\n" +
+		"220 FTP server ready\r\n" +
+		"USER anonymous\r\n" +
+		"331 Password required\r\n" +
+		"RETR /pub/file.txt\r\n" +
+		"226 Transfer complete\r\n"
+
+	d, err := newDigest("sha1", Base16)
+	require.NoError(t, err)
+	block, err := newFtpControlBlock(&warcRecordOptions{}, strings.NewReader(content), d, &Validation{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []FtpControlLine{
+		{Reply: true, Code: 220, Text: "Welcome"},
+		{Reply: true, Code: 220, Text: "FTP server ready"},
+		{Command: "USER", Text: "anonymous"},
+		{Reply: true, Code: 331, Text: "Password required"},
+		{Command: "RETR", Text: "/pub/file.txt"},
+		{Reply: true, Code: 226, Text: "Transfer complete"},
+	}, block.Lines())
+	assert.Equal(t, int64(len(content)), block.Size())
+}
+
+func Test_parseBlock_dnsRecord(t *testing.T) {
+	content := "20060102150405\r\nexample.com.\t3600\tIN\tA\t93.184.216.34\r\n"
+	data := "WARC/1.1\r\n" +
+		"WARC-Type: response\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Date: 2006-01-02T15:04:05Z\r\n" +
+		"WARC-Target-URI: dns:example.com\r\n" +
+		"Content-Type: text/dns\r\n" +
+		"Content-Length: " + strconv.Itoa(len(content)) + "\r\n" +
+		"\r\n" + content + "\r\n\r\n"
+
+	record, _, validation, err := NewUnmarshaler().Unmarshal(bufio.NewReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	assert.True(t, validation.Valid(), validation.String())
+	defer func() { _ = record.Close() }()
+
+	block, ok := record.Block().(DnsBlock)
+	require.True(t, ok, "expected DnsBlock, got %T", record.Block())
+	assert.Equal(t, []net.IP{net.ParseIP("93.184.216.34")}, block.IPAddresses())
+}
+
+func Test_parseBlock_dnsRecordOverflowsToDisk(t *testing.T) {
+	content := "20060102150405\r\n" + strings.Repeat("example.com.\t3600\tIN\tA\t93.184.216.34\r\n", 100)
+	data := "WARC/1.1\r\n" +
+		"WARC-Type: resource\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Date: 2006-01-02T15:04:05Z\r\n" +
+		"WARC-Target-URI: dns:example.com\r\n" +
+		"Content-Type: text/dns\r\n" +
+		"Content-Length: " + strconv.Itoa(len(content)) + "\r\n" +
+		"\r\n" + content + "\r\n\r\n"
+
+	dir := t.TempDir()
+	record, _, validation, err := NewUnmarshaler(WithBufferMaxMemBytes(64), WithBufferTmpDir(dir)).
+		Unmarshal(bufio.NewReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	assert.True(t, validation.Valid(), validation.String())
+
+	block, ok := record.Block().(DnsBlock)
+	require.True(t, ok, "expected DnsBlock, got %T", record.Block())
+	assert.Len(t, block.ResourceRecords(), 100)
+	assert.Equal(t, int64(len(content)), block.Size())
+	r, err := block.RawBytes()
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(b))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// The temporary file is removed when the record is closed
+	require.NoError(t, record.Close())
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func Test_parseBlock_dnsRecordTooLongLine(t *testing.T) {
+	content := "20060102150405\r\nexample.com.\t3600\tIN\tTXT\t" + strings.Repeat("x", bufio.MaxScanTokenSize) + "\r\n"
+	data := "WARC/1.1\r\n" +
+		"WARC-Type: response\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Date: 2006-01-02T15:04:05Z\r\n" +
+		"WARC-Target-URI: dns:example.com\r\n" +
+		"Content-Type: text/dns\r\n" +
+		"Content-Length: " + strconv.Itoa(len(content)) + "\r\n" +
+		"\r\n" + content + "\r\n\r\n"
+
+	record, _, validation, err := NewUnmarshaler(WithBlockErrorPolicy(ErrWarn)).
+		Unmarshal(bufio.NewReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	defer func() { _ = record.Close() }()
+	require.Len(t, *validation, 1, validation.String())
+	assert.ErrorContains(t, (*validation)[0], "error in dns block at line 2: failed to read dns block")
+	assert.ErrorIs(t, (*validation)[0], bufio.ErrTooLong)
+
+	_, _, _, err = NewUnmarshaler(WithBlockErrorPolicy(ErrFail)).Unmarshal(bufio.NewReader(strings.NewReader(data)))
+	assert.ErrorIs(t, err, bufio.ErrTooLong)
+}
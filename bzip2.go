@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// bzip2HeaderLen is the length of the header starting a bzip2 stream: the magic 'BZh', the block size and the
+// magic of the first block.
+const bzip2HeaderLen = 10
+
+var bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+
+// isBzip2Header returns true if b starts with the header of a bzip2 stream.
+func isBzip2Header(b []byte) bool {
+	return len(b) >= bzip2HeaderLen && b[0] == 'B' && b[1] == 'Z' && b[2] == 'h' && b[3] >= '1' && b[3] <= '9' &&
+		bytes.Equal(b[4:bzip2HeaderLen], bzip2BlockMagic)
+}
+
+// bzip2MemberReader reads a single bzip2 compressed member from a WARC file.
+//
+// The bzip2 decoder in the standard library continues reading when a stream is followed by another stream, so it
+// can't be used for finding the end of a member. Instead the member is ended at the start of the next stream, which
+// is recognized by its header. The header contains the byte aligned magic of the first block, which is very unlikely
+// to appear by chance in compressed data.
+type bzip2MemberReader struct {
+	r       *bufio.Reader
+	started bool
+	eof     bool
+}
+
+func (m *bzip2MemberReader) Read(p []byte) (int, error) {
+	if m.eof || len(p) == 0 {
+		return 0, io.EOF
+	}
+	b, err := m.r.Peek(m.r.Size())
+	if len(b) == 0 {
+		return 0, err
+	}
+	atEOF := err != nil
+
+	// Skip the header of this member
+	start := 0
+	if !m.started {
+		start = 1
+	}
+
+	// Find the start of the next member. Bytes which might be the beginning of a header are held back until more
+	// input is available.
+	end := len(b)
+	for i := start; i < len(b); i++ {
+		if b[i] != 'B' {
+			continue
+		}
+		if isBzip2Header(b[i:]) {
+			end = i
+			break
+		}
+		if !atEOF && len(b)-i < bzip2HeaderLen {
+			end = i
+			break
+		}
+	}
+	if end == 0 {
+		if m.started {
+			m.eof = true
+			return 0, io.EOF
+		}
+		end = 1
+	}
+	m.started = true
+
+	if end > len(p) {
+		end = len(p)
+	}
+	n, _ := m.r.Read(p[:end])
+	return n, nil
+}
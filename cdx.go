@@ -0,0 +1,192 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nlnwa/gowarc/v2/internal/timestamp"
+	"github.com/nlnwa/whatwg-url/canonicalizer"
+)
+
+// cdxjRecordTypes are the record types which are indexed in CDXJ.
+const cdxjRecordTypes = Response | Resource | Revisit | Metadata | Conversion
+
+// cdxjFields holds the JSON block of a CDXJ line.
+type cdxjFields struct {
+	Url      string `json:"url"`
+	Mime     string `json:"mime,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Length   string `json:"length"`
+	Offset   string `json:"offset"`
+	Filename string `json:"filename"`
+}
+
+// cdxjLine formats a CDXJ line for a record written to fileName at offset with length bytes.
+//
+// The line consists of the key made by keyFunc from WARC-Target-URI, the 14-digit WARC-Date and a JSON block. It is terminated by a
+// newline. Only records with a WARC-Target-URI of a type in cdxjRecordTypes are indexed, ok is false for other records.
+// The mime field is taken from WARC-Identified-Payload-Type if present, otherwise from the HTTP or WARC Content-Type.
+// The values of the WARC header fields in headerFields are added to the JSON block with the field name as key.
+func cdxjLine(record WarcRecord, keyFunc func(uri string) string, headerFields []string, fileName string, offset, length int64) (line []byte, ok bool, err error) {
+	uri := record.WarcHeader().Get(WarcTargetURI)
+	if uri == "" || record.Type()&cdxjRecordTypes == 0 {
+		return nil, false, nil
+	}
+	ts, err := timestamp.To14(record.WarcHeader().Get(WarcDate))
+	if err != nil {
+		return nil, false, err
+	}
+
+	fields := cdxjFields{
+		Url:      uri,
+		Mime:     mediaType(record.WarcHeader().Get(ContentType)),
+		Digest:   record.WarcHeader().Get(WarcPayloadDigest),
+		Length:   strconv.FormatInt(length, 10),
+		Offset:   strconv.FormatInt(offset, 10),
+		Filename: fileName,
+	}
+	if fields.Digest == "" {
+		fields.Digest = record.WarcHeader().Get(WarcBlockDigest)
+	}
+	switch b := record.Block().(type) {
+	case HttpResponseBlock:
+		fields.Status = strconv.Itoa(b.HttpStatusCode())
+		if h := b.HttpHeader(); h != nil {
+			fields.Mime = mediaType(h.Get(ContentType))
+		}
+	}
+	if mt := mediaType(record.WarcHeader().Get(WarcIdentifiedPayloadType)); mt != "" {
+		fields.Mime = mt
+	}
+	if record.Type() == Revisit {
+		fields.Mime = "warc/revisit"
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(keyFunc(uri))
+	buf.WriteByte(' ')
+	buf.WriteString(ts)
+	buf.WriteByte(' ')
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	// Encode terminates the line with a newline
+	if err := enc.Encode(fields); err != nil {
+		return nil, false, err
+	}
+	if len(headerFields) == 0 {
+		return buf.Bytes(), true, nil
+	}
+
+	// Reopen the JSON object to add the header fields
+	buf.Truncate(buf.Len() - len("}\n"))
+	for _, name := range headerFields {
+		if !record.WarcHeader().Has(name) {
+			continue
+		}
+		buf.WriteByte(',')
+		if err := enc.Encode(name); err != nil {
+			return nil, false, err
+		}
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		if err := enc.Encode(record.WarcHeader().Get(name)); err != nil {
+			return nil, false, err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), true, nil
+}
+
+// mediaType returns the media type of a Content-Type value without parameters.
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// Surt returns the Sort-friendly URI Reordering Transform of uri as used for CDX keys, e.g.
+// http://www.example.com/path?b=2&a=1 becomes com,example)/path?a=1&b=2.
+//
+// This is the default key function of [WithCdxKeyFunc]. A lookup in an index written with the default should make its
+// key with Surt. If uri can't be parsed, the lower-cased uri is returned.
+func Surt(uri string) string {
+	u, err := canonicalizer.WhatWgSortQuery.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return strings.ToLower(uri)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	var key strings.Builder
+	if u.IsIPv4() || u.IsIPv6() {
+		key.WriteString(host)
+	} else {
+		labels := strings.Split(host, ".")
+		for i := len(labels) - 1; i >= 0; i-- {
+			key.WriteString(labels[i])
+			if i > 0 {
+				key.WriteByte(',')
+			}
+		}
+	}
+	if port := u.Port(); port != "" {
+		key.WriteByte(':')
+		key.WriteString(port)
+	}
+	key.WriteByte(')')
+	key.WriteString(strings.ToLower(u.Pathname() + u.Search()))
+	return key.String()
+}
+
+// cdxFileName returns the name of the CDXJ file accompanying a WARC file, e.g. foo.cdxj for foo.warc.gz.
+func cdxFileName(warcFileName, compressSuffix string) string {
+	return sidecarFileName(warcFileName, compressSuffix, ".cdxj")
+}
+
+// sidecarFileName returns the name of a file accompanying a WARC file by replacing the extension of the WARC file with
+// ext.
+func sidecarFileName(warcFileName, compressSuffix, ext string) string {
+	name := strings.TrimSuffix(warcFileName, compressSuffix)
+	return strings.TrimSuffix(name, path.Ext(name)) + ext
+}
+
+// cdxWriter serializes writes of CDX lines from concurrent file writers.
+type cdxWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// write writes a line to the underlying writer. If the writer is buffered, i.e. has a Flush method, it is flushed to
+// ensure that only whole lines are left if the process crashes.
+func (c *cdxWriter) write(line []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.w.Write(line); err != nil {
+		return err
+	}
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSurt(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"http://www.example.com/", "com,example)/"},
+		{"https://Sub.Example.com/Path?b=2&a=1#frag", "com,example,sub)/path?a=1&b=2"},
+		{"http://example.com:8080/index.html", "com,example:8080)/index.html"},
+		{"http://127.0.0.1/", "127.0.0.1)/"},
+		{"dns:www.example.com", "dns:www.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			assert.Equal(t, tt.want, Surt(tt.uri))
+		})
+	}
+}
+
+func TestWarcFileWriter_WithCdxWriter(t *testing.T) {
+	cdx := &bytes.Buffer{}
+	w := NewWarcFileWriter(
+		WithFileSystem(NewMemFileSystem()),
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(0),
+		WithCdxWriter(cdx))
+
+	for i := 0; i < 2; i++ {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+		res := w.Write(record)
+		require.NoError(t, res[0].Err)
+	}
+	// Records without a target URI are not indexed
+	res := w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+
+	// The records are longer than the test record by the added "WARC-Target-URI: http://www.example.com/\r\n" line
+	size := uncompressedRecordSize + 42
+	line := `com,example)/ 20060102150405 {"url":"http://www.example.com/","mime":"text/plain","status":"200",` +
+		`"digest":"sha1:7CBE117BFA2B22C3A02DEFF3BC04D5F912964A45","length":"%d","offset":"%d","filename":"test-0001.warc"}`
+	assert.Equal(t, fmt.Sprintf(line, size, 0)+"\n"+fmt.Sprintf(line, size, size)+"\n", cdx.String())
+}
+
+func TestCdxjLine_identifiedPayloadType(t *testing.T) {
+	record := createTestRecord()
+	record.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+	record.WarcHeader().Set(WarcIdentifiedPayloadType, "text/html")
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	line, ok, err := cdxjLine(record, Surt, nil, "test.warc", 0, uncompressedRecordSize)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Contains(t, string(line), `"mime":"text/html"`)
+}
+
+func TestCdxjLine_headerFields(t *testing.T) {
+	record := createTestRecord()
+	record.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+	record.WarcHeader().Set(WarcPageID, "<page \"1\">")
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	line, ok, err := cdxjLine(record, Surt, []string{WarcPageID, WarcResourceType}, "test.warc", 0, uncompressedRecordSize)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.True(t, strings.HasSuffix(string(line), `"filename":"test.warc","WARC-Page-ID":"<page \"1\">"}`+"\n"), string(line))
+}
+
+func TestWarcFileWriter_WithCdxKeyFunc(t *testing.T) {
+	cdx := &bytes.Buffer{}
+	w := NewWarcFileWriter(
+		WithFileSystem(NewMemFileSystem()),
+		WithCompression(false),
+		WithCdxWriter(cdx),
+		WithCdxKeyFunc(strings.ToUpper))
+
+	record := createTestRecord()
+	record.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+	res := w.Write(record)
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+
+	assert.True(t, strings.HasPrefix(cdx.String(), "HTTP://WWW.EXAMPLE.COM/ 20060102150405 {"), cdx.String())
+}
+
+func TestWarcFileWriter_WithCdxFile(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithFileNameGenerator(&PatternNameGenerator{Directory: "mem", Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(compressedRecordSize+1),
+		WithCdxFile(true))
+
+	var results []WriteResponse
+	for i := 0; i < 3; i++ {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+		res := w.Write(record)
+		require.NoError(t, res[0].Err)
+		results = append(results, res[0])
+	}
+	assert.Equal(t, []string{
+		"mem/test-0001.cdxj", "mem/test-0001.warc.gz",
+		"mem/test-0002.cdxj", "mem/test-0002.warc.gz",
+		"mem/test-0003.cdxj.open", "mem/test-0003.warc.gz.open",
+	}, m.Names())
+	require.NoError(t, w.Close())
+
+	// Each WARC file is indexed in its own CDX file
+	for i, res := range results {
+		cdxName := fmt.Sprintf("mem/test-%04d.cdxj", i+1)
+		b, err := m.ReadFile(cdxName)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		require.Len(t, lines, 1, cdxName)
+		assert.Contains(t, lines[0], fmt.Sprintf(`"offset":"%d","filename":"%s"`, res.FileOffset, res.FileName))
+	}
+}
+
+func TestCdxFileName(t *testing.T) {
+	assert.Equal(t, "foo.cdxj", cdxFileName("foo.warc.gz", ".gz"))
+	assert.Equal(t, "foo.cdxj", cdxFileName("foo.warc", ".gz"))
+	assert.Equal(t, "foo-1.0.cdxj", cdxFileName("foo-1.0.warc", ""))
+}
+
+// failOnceWriter fails the first write and passes the following writes to w.
+type failOnceWriter struct {
+	w      io.Writer
+	failed bool
+}
+
+func (f *failOnceWriter) Write(p []byte) (int, error) {
+	if !f.failed {
+		f.failed = true
+		return 0, errors.New("write failed")
+	}
+	return f.w.Write(p)
+}
+
+func TestWarcFileWriter_WithCdxWriter_writeError(t *testing.T) {
+	cdx := &bytes.Buffer{}
+	w := NewWarcFileWriter(
+		WithFileSystem(NewMemFileSystem()),
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(0),
+		WithCdxWriter(&failOnceWriter{w: cdx}))
+
+	var offsets []int64
+	for i := 0; i < 2; i++ {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+		res := w.Write(record)
+		offsets = append(offsets, res[0].FileOffset)
+		if i == 0 {
+			assert.Error(t, res[0].Err)
+		} else {
+			assert.NoError(t, res[0].Err)
+		}
+	}
+	require.NoError(t, w.Close())
+
+	// The failed CDX line doesn't affect the offset and length of the next record
+	size := uncompressedRecordSize + 42
+	assert.Equal(t, []int64{0, size}, offsets)
+	assert.Contains(t, cdx.String(), fmt.Sprintf(`"length":"%d","offset":"%d"`, size, size))
+}
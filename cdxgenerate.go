@@ -0,0 +1,241 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// CdxOptions configures [GenerateCDX]. The zero value is ready to use.
+type CdxOptions struct {
+	// KeyFunc makes the key of a line from the WARC-Target-URI. Defaults to [Surt].
+	KeyFunc func(uri string) string
+	// HeaderFields are WARC header fields to add to the JSON block, see [WithCdxHeaderFields].
+	HeaderFields []string
+	// MaxMemory is the number of bytes of lines to sort in memory. If the lines of a file take more, sorted runs are
+	// written to temporary files and merged. Everything is sorted in memory if MaxMemory is 0.
+	MaxMemory int64
+	// TmpDir is the directory for the temporary files. Defaults to [os.TempDir].
+	TmpDir string
+	// RecordOptions are the options used for reading the WARC file.
+	RecordOptions []WarcRecordOption
+}
+
+// GenerateCDX reads the WARC file at warcPath and writes a sorted CDXJ index of it to w.
+//
+// The lines are the same as written by [WithCdxFile] when the file is written, with the base name of warcPath as the
+// filename field, but sorted bytewise by key and timestamp. The index can be searched with binary search or merged
+// with indexes of other files. Lines are sorted in memory, or with a merge sort using temporary files if
+// CdxOptions.MaxMemory is set. opts might be nil.
+//
+// An error is returned if the file can't be read, if a record fails validation according to the record options or if
+// writing to w fails.
+func GenerateCDX(warcPath string, w io.Writer, opts *CdxOptions) (err error) {
+	if opts == nil {
+		opts = &CdxOptions{}
+	}
+	keyFunc := opts.KeyFunc
+	if keyFunc == nil {
+		keyFunc = Surt
+	}
+
+	r, err := NewWarcFileReader(warcPath, 0, opts.RecordOptions...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	s := &cdxSorter{maxMemory: opts.MaxMemory, tmpDir: opts.TmpDir}
+	defer s.removeRuns()
+
+	fileName := filepath.Base(warcPath)
+	for {
+		record, offset, _, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if record != nil {
+				_ = record.Close()
+			}
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		size, _ := r.LastRecordSize()
+		line, ok, err := cdxjLine(record, keyFunc, opts.HeaderFields, fileName, offset, size)
+		_ = record.Close()
+		if err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		if ok {
+			if err := s.add(line); err != nil {
+				return err
+			}
+		}
+	}
+	return s.writeTo(w)
+}
+
+// cdxSorter sorts lines in memory, spilling sorted runs to temporary files when maxMemory is exceeded.
+type cdxSorter struct {
+	maxMemory int64
+	tmpDir    string
+	lines     [][]byte
+	size      int64
+	runs      []string
+}
+
+func (s *cdxSorter) add(line []byte) error {
+	s.lines = append(s.lines, line)
+	s.size += int64(len(line))
+	if s.maxMemory > 0 && s.size > s.maxMemory {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *cdxSorter) sort() {
+	sort.Slice(s.lines, func(i, j int) bool { return bytes.Compare(s.lines[i], s.lines[j]) < 0 })
+}
+
+// spill writes the lines in memory as a sorted run to a temporary file.
+func (s *cdxSorter) spill() error {
+	f, err := os.CreateTemp(s.tmpDir, "gowarc-cdx-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	s.sort()
+	bw := bufio.NewWriter(f)
+	for _, line := range s.lines {
+		if _, err := bw.Write(line); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.lines, s.size = nil, 0
+	return f.Close()
+}
+
+// writeTo writes all lines in sorted order to w.
+func (s *cdxSorter) writeTo(w io.Writer) error {
+	if len(s.runs) == 0 {
+		s.sort()
+		bw := bufio.NewWriter(w)
+		for _, line := range s.lines {
+			if _, err := bw.Write(line); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+
+	if len(s.lines) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	h := make(cdxRunHeap, 0, len(s.runs))
+	defer func() {
+		for _, run := range h {
+			_ = run.f.Close()
+		}
+	}()
+	for _, name := range s.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		run := &cdxRun{f: f, r: bufio.NewReader(f)}
+		if ok, err := run.next(); err != nil {
+			_ = f.Close()
+			return err
+		} else if !ok {
+			_ = f.Close()
+			continue
+		}
+		h = append(h, run)
+	}
+	heap.Init(&h)
+
+	bw := bufio.NewWriter(w)
+	for len(h) > 0 {
+		run := h[0]
+		if _, err := bw.Write(run.line); err != nil {
+			return err
+		}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			_ = run.f.Close()
+			heap.Pop(&h)
+		}
+	}
+	return bw.Flush()
+}
+
+// removeRuns removes the temporary files.
+func (s *cdxSorter) removeRuns() {
+	for _, name := range s.runs {
+		_ = os.Remove(name)
+	}
+}
+
+// cdxRun is a sorted run read back from a temporary file.
+type cdxRun struct {
+	f    *os.File
+	r    *bufio.Reader
+	line []byte
+}
+
+// next reads the next line of the run. ok is false at end of the run.
+func (run *cdxRun) next() (ok bool, err error) {
+	run.line, err = run.r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) {
+		return len(run.line) > 0, nil
+	}
+	return err == nil, err
+}
+
+// cdxRunHeap implements heap.Interface ordering runs by their current line.
+type cdxRunHeap []*cdxRun
+
+func (h cdxRunHeap) Len() int           { return len(h) }
+func (h cdxRunHeap) Less(i, j int) bool { return bytes.Compare(h[i].line, h[j].line) < 0 }
+func (h cdxRunHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *cdxRunHeap) Push(x any)        { *h = append(*h, x.(*cdxRun)) }
+func (h *cdxRunHeap) Pop() any {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateCDX(t *testing.T) {
+	var records []WarcRecord
+	for _, uri := range []string{"http://c.example.com/", "http://a.example.com/", "http://b.example.com/", "http://a.example.com/"} {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcTargetURI, uri)
+		records = append(records, record)
+	}
+	filename := writeTestFile(t, t.TempDir(), records...)
+
+	inMemory := &bytes.Buffer{}
+	require.NoError(t, GenerateCDX(filename, inMemory, nil))
+	lines := strings.Split(strings.TrimSuffix(inMemory.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	assert.True(t, sort.StringsAreSorted(lines), lines)
+	assert.True(t, strings.HasPrefix(lines[0], "com,example,a)/ 20060102150405 {"), lines[0])
+	assert.Contains(t, lines[3], `"offset":"0","filename":"test-0001.warc"`)
+
+	// Spill every line to a run of its own
+	tmpDir := t.TempDir()
+	merged := &bytes.Buffer{}
+	require.NoError(t, GenerateCDX(filename, merged, &CdxOptions{MaxMemory: 1, TmpDir: tmpDir}))
+	assert.Equal(t, inMemory.String(), merged.String())
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
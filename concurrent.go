@@ -0,0 +1,55 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"slices"
+)
+
+// LinkConcurrentRecords cross-references records which were captured together, e.g. a request and its response.
+//
+// Every record gets a WARC-Concurrent-To header for each of the other records, and all records get the WARC-Date of
+// the first record. References which are already present are not added twice.
+//
+// The records must have a WARC-Record-ID.
+func LinkConcurrentRecords(records ...WarcRecord) {
+	if len(records) < 2 {
+		return
+	}
+	addConcurrentTo(records...)
+	if date := records[0].WarcHeader().Get(WarcDate); date != "" {
+		for _, r := range records[1:] {
+			r.WarcHeader().Set(WarcDate, date)
+		}
+	}
+}
+
+// addConcurrentTo adds WARC-Concurrent-To headers to every record referencing all the other records.
+func addConcurrentTo(records ...WarcRecord) {
+	for k, wr := range records {
+		for k2, wr2 := range records {
+			if k == k2 {
+				continue
+			}
+			id := wr2.WarcHeader().Get(WarcRecordID)
+			if id == "" || slices.Contains(wr.WarcHeader().GetAll(WarcConcurrentTo), id) {
+				continue
+			}
+			wr.WarcHeader().AddId(WarcConcurrentTo, id)
+		}
+	}
+}
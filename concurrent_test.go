@@ -0,0 +1,42 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkConcurrentRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	req := createTestRecord()
+	req.WarcHeader().Set(WarcRecordID, "<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>")
+	req.WarcHeader().Set(WarcDate, "2006-01-02T15:04:05Z")
+	resp := createTestRecord()
+	resp.WarcHeader().Set(WarcRecordID, "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>")
+	resp.WarcHeader().Set(WarcDate, "2006-01-02T15:04:06Z")
+
+	LinkConcurrentRecords(req, resp)
+	// Linking twice should not add duplicate references
+	LinkConcurrentRecords(req, resp)
+
+	assert.Equal([]string{"<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>"}, req.WarcHeader().GetAll(WarcConcurrentTo))
+	assert.Equal([]string{"<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>"}, resp.WarcHeader().GetAll(WarcConcurrentTo))
+	assert.Equal("2006-01-02T15:04:05Z", resp.WarcHeader().Get(WarcDate))
+}
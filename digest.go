@@ -207,15 +207,22 @@ func newDigest(digestString string, defaultEncoding digestEncoding) (*digest, er
 	}
 }
 
+// DigestSpec describes the digest to compute for a digest field. See [WithDigests].
+type DigestSpec struct {
+	Field     string         // WarcBlockDigest or WarcPayloadDigest
+	Algorithm string         // One of md5, sha1, sha256 or sha512. The default algorithm is used if empty
+	Encoding  digestEncoding // Base16, Base32 or Base64. The default encoding is used if not set
+}
+
 // newDigestFromField takes a warcRecord and a digest-field name and creates a new digest from it.
 //
-// If the digest-field is missing from the warcRecord a digest is created with the default algorithm and encoding set
-// in the warcRecord's options
+// If the digest-field is missing from the warcRecord a digest is created with the algorithm and encoding set for the
+// field in the warcRecord's options
 func newDigestFromField(wr *warcRecord, warcDigestField string) (d *digest, err error) {
 	if wr.WarcHeader().Has(warcDigestField) {
 		d, err = newDigest(wr.WarcHeader().Get(warcDigestField), wr.opts.defaultDigestEncoding)
 	} else {
-		d, err = newDigest(wr.opts.defaultDigestAlgorithm, wr.opts.defaultDigestEncoding)
+		d, err = newDigest(wr.opts.digestFor(warcDigestField))
 	}
 	return
 }
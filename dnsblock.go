@@ -0,0 +1,138 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DnsBlock is the block of a record holding a DNS lookup, i.e. a record with the content type text/dns.
+//
+// The content is expected to be in the format written by Heritrix: the 14-digit fetch time on the first line,
+// followed by the resource records of the answer in zone file format.
+//
+//	20060102150405
+//	example.com.	3600	IN	A	93.184.216.34
+type DnsBlock interface {
+	Block
+	// FetchTime returns the time of the lookup. The zero time is returned if the block has no valid fetch time.
+	FetchTime() time.Time
+	// ResourceRecords returns the resource records in the answer.
+	ResourceRecords() []DnsResourceRecord
+	// IPAddresses returns the addresses of all A and AAAA records in the answer.
+	IPAddresses() []net.IP
+}
+
+// DnsResourceRecord is a resource record in a DNS answer.
+type DnsResourceRecord struct {
+	Name  string
+	TTL   uint32
+	Class string
+	Type  string
+	Data  string // The record data, e.g. the address of an A record
+}
+
+type dnsBlock struct {
+	bufferedBlock
+	fetchTime time.Time
+	records   []DnsResourceRecord
+}
+
+func (block *dnsBlock) FetchTime() time.Time {
+	return block.fetchTime
+}
+
+func (block *dnsBlock) ResourceRecords() []DnsResourceRecord {
+	return block.records
+}
+
+func (block *dnsBlock) IPAddresses() []net.IP {
+	var ips []net.IP
+	for _, rr := range block.records {
+		if rr.Type == "A" || rr.Type == "AAAA" {
+			if ip := net.ParseIP(rr.Data); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+func newDnsBlock(opts *warcRecordOptions, rb io.Reader, d *digest, validation *Validation) (DnsBlock, error) {
+	block := &dnsBlock{bufferedBlock: bufferedBlock{blockDigest: d}}
+	if err := block.readContent(opts, rb, validation); err != nil {
+		return block, err
+	}
+
+	blockValidation := Validation{}
+	pos := &position{}
+	scanner := bufio.NewScanner(block.content.Slice(0, 0))
+	for scanner.Scan() {
+		pos.incrLineNumber()
+		line := strings.TrimSpace(scanner.Text())
+		if pos.lineNumber == 1 {
+			t, err := time.Parse("20060102150405", line)
+			if err != nil {
+				blockValidation.addError(newSyntaxError("invalid dns fetch time: '"+line+"'", pos))
+			}
+			block.fetchTime = t
+			continue
+		}
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			blockValidation.addError(newSyntaxError("invalid dns resource record: '"+line+"'", pos))
+			continue
+		}
+		ttl, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			blockValidation.addError(newSyntaxError("invalid dns ttl: '"+fields[1]+"'", pos))
+			continue
+		}
+		block.records = append(block.records, DnsResourceRecord{
+			Name:  fields[0],
+			TTL:   uint32(ttl),
+			Class: fields[2],
+			Type:  strings.ToUpper(fields[3]),
+			Data:  strings.Join(fields[4:], " "),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		// The records after the failing line are missing
+		blockValidation.addError(newWrappedSyntaxError("failed to read dns block", &position{lineNumber: pos.lineNumber + 1}, err))
+	}
+
+	if opts.errBlock > ErrIgnore && !blockValidation.Valid() {
+		switch opts.errBlock {
+		case ErrWarn:
+			for _, e := range blockValidation {
+				validation.addError(newWrappedSyntaxError("error in dns block", nil, e))
+			}
+		case ErrFail:
+			return block, newWrappedSyntaxError("error in dns block", nil, blockValidation[0])
+		}
+	}
+	return block, nil
+}
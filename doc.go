@@ -29,6 +29,8 @@ For more details, visit the WARC specification: https://iipc.github.io/warc-spec
 The [WarcRecordBuilder], initialized via [NewRecordBuilder], is the primary tool for creating WARC records.
 By default, the WarcRecordBuilder generates a record id and calculates the 'Content-Length' and 'WARC-Block-Digest'.
 
+Records captured together, like a request and its response, can be cross-referenced with [LinkConcurrentRecords].
+
 Use [WarcFileWriter], initialized with [NewWarcFileWriter], to write WARC files.
 
 # WARC record parsing
@@ -42,5 +44,8 @@ To read entire WARC files, employ the [WarcFileReader] initialized through [NewW
 The gowarc package supports validation during both the creation and parsing of WARC records.
 Control over the scope of validation and the handling of validation errors can be achieved by setting the appropriate
 options in the [WarcRecordBuilder], [Unmarshaler], or [WarcFileReader].
+
+Use [ValidateFile] to validate all records in a WARC file, including references between records.
+Records can be recovered from a damaged WARC file with [ScanRecords].
 */
 package gowarc
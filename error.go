@@ -18,9 +18,15 @@ package gowarc
 
 import (
 	"fmt"
+	"io"
 	"strings"
 )
 
+// ErrUnexpectedEOF is returned when the input ends in the middle of a record, e.g. when a WARC file is truncated.
+//
+// A clean end of input at a record boundary is reported as io.EOF. ErrUnexpectedEOF wraps io.ErrUnexpectedEOF.
+var ErrUnexpectedEOF = fmt.Errorf("gowarc: %w", io.ErrUnexpectedEOF)
+
 // HeaderFieldError is used for violations of WARC header specification
 type HeaderFieldError struct {
 	fieldName string
@@ -85,6 +91,11 @@ func (e *SyntaxError) Unwrap() error {
 
 type multiErr []error
 
+// Unwrap returns the wrapped errors. This makes errors.Is and errors.As work for each of the errors.
+func (e multiErr) Unwrap() []error {
+	return e
+}
+
 func (e multiErr) Error() string {
 	switch len(e) {
 
@@ -0,0 +1,255 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+)
+
+// FileSystem is the interface used by [WarcFileWriter] for creating and renaming files.
+//
+// The default implementation uses the os package. Use [WithFileSystem] to write to another backend, e.g. a
+// [MemFileSystem] for tests and benchmarks.
+type FileSystem interface {
+	// OpenFile opens the named file with specified flag (os.O_RDWR etc.) and perm.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+
+	// Rename renames (moves) oldpath to newpath.
+	//
+	// The rename is expected to be atomic. WarcFileWriter relies on this to guarantee that a file without the open
+	// file suffix is always complete.
+	Rename(oldpath, newpath string) error
+}
+
+// File is the interface implemented by files returned from a [FileSystem].
+type File interface {
+	io.Writer
+	io.Closer
+
+	// Name returns the name of the file as presented to OpenFile.
+	Name() string
+
+	// Sync commits the current contents of the file to stable storage.
+	Sync() error
+
+	// Stat returns the FileInfo structure describing the file.
+	Stat() (os.FileInfo, error)
+}
+
+// osFileSystem implements FileSystem using the os package.
+type osFileSystem struct{}
+
+func (osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Rename renames the file and syncs the parent directory to make the rename durable.
+func (osFileSystem) Rename(oldpath, newpath string) error {
+	return fileutil.Rename(oldpath, newpath)
+}
+
+// MemFileSystem is a FileSystem that keeps all files in memory.
+//
+// It is mainly intended for tests and benchmarks. Use [NewMemFileSystem] to create a new instance.
+type MemFileSystem struct {
+	mu    sync.Mutex
+	files map[string]*memFileData
+}
+
+// NewMemFileSystem creates a new empty MemFileSystem.
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{files: make(map[string]*memFileData)}
+}
+
+type memFileData struct {
+	buf     bytes.Buffer
+	modTime time.Time
+}
+
+// OpenFile implements FileSystem.
+//
+// Only the flags os.O_CREATE, os.O_EXCL and os.O_TRUNC are honored. The file is always opened for writing.
+func (m *MemFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[name]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		data = &memFileData{modTime: time.Now()}
+		m.files[name] = data
+	case flag&os.O_TRUNC != 0:
+		data.buf.Reset()
+	}
+	return &memFile{fs: m, name: name, data: data, perm: perm}, nil
+}
+
+// Rename implements FileSystem.
+func (m *MemFileSystem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = data
+	return nil
+}
+
+// ReadFile returns a copy of the content of the named file.
+func (m *MemFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(data.buf.Bytes()), nil
+}
+
+// Names returns the sorted names of all files in the MemFileSystem.
+func (m *MemFileSystem) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// memFile is a File in a MemFileSystem.
+type memFile struct {
+	fs     *MemFileSystem
+	name   string
+	data   *memFileData
+	perm   os.FileMode
+	closed bool
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.data.modTime = time.Now()
+	return f.data.buf.Write(p)
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	return &memFileInfo{name: filepath.Base(f.name), size: int64(f.data.buf.Len()), mode: f.perm, modTime: f.data.modTime}, nil
+}
+
+// memFileInfo implements os.FileInfo for a memFile.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return false }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
+
+// errFileUsed is returned when a WarcFileWriter set up with WithFile needs another file.
+var errFileUsed = errors.New("gowarc: the file given to WithFile is already used")
+
+// preopenedFileSystem is the FileSystem used by [WithFile].
+//
+// The first call to OpenFile returns the file, whatever the name is. Later calls fail since the file can only be
+// written once. It is also used as the WarcFileNameGenerator, returning the name of the file.
+type preopenedFileSystem struct {
+	mu   sync.Mutex
+	file File
+	used bool
+	name string
+}
+
+func (p *preopenedFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.used {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errFileUsed}
+	}
+	p.used = true
+	return p.file, nil
+}
+
+// Rename only accepts renaming the file to its own name, since the writer doesn't use an open file suffix for the
+// file.
+func (p *preopenedFileSystem) Rename(oldpath, newpath string) error {
+	if oldpath != newpath {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+func (p *preopenedFileSystem) NewWarcfileName() (string, string) {
+	return "", p.name
+}
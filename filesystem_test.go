@@ -0,0 +1,322 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFileSystem(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMemFileSystem()
+
+	f, err := m.OpenFile("dir/foo.open", os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("hello"))
+	assert.NoError(err)
+	fi, err := f.Stat()
+	assert.NoError(err)
+	assert.Equal(int64(5), fi.Size())
+	assert.Equal("foo.open", fi.Name())
+
+	_, err = m.OpenFile("dir/foo.open", os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	assert.True(errors.Is(err, fs.ErrExist))
+
+	assert.NoError(f.Close())
+	_, err = f.Write([]byte("again"))
+	assert.True(errors.Is(err, fs.ErrClosed))
+
+	assert.NoError(m.Rename("dir/foo.open", "dir/foo"))
+	assert.Equal([]string{"dir/foo"}, m.Names())
+	b, err := m.ReadFile("dir/foo")
+	assert.NoError(err)
+	assert.Equal("hello", string(b))
+
+	_, err = m.ReadFile("dir/foo.open")
+	assert.True(errors.Is(err, fs.ErrNotExist))
+}
+
+func TestWarcFileWriter_Write_MemFileSystem(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMemFileSystem()
+
+	nameGenerator := &PatternNameGenerator{Directory: "mem", Pattern: "test-%04{serial}d.warc"}
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(true),
+		WithFileNameGenerator(nameGenerator),
+		WithMaxFileSize(0))
+
+	res := w.Write(createTestRecord())
+	assert.NoError(res[0].Err)
+	assert.Equal([]string{"mem/test-0001.warc.gz.open"}, m.Names())
+	assert.NoError(w.Close())
+	assert.Equal([]string{"mem/test-0001.warc.gz"}, m.Names())
+
+	b, err := m.ReadFile("mem/test-0001.warc.gz")
+	require.NoError(t, err)
+	assert.Equal(compressedRecordSize, int64(len(b)))
+
+	r, err := NewWarcFileReaderFromStream(bytes.NewReader(b), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(r.Close()) }()
+	record, offset, validation, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(int64(0), offset)
+	assert.True(validation.Valid(), validation.String())
+	assert.Equal(createTestRecord().RecordId(), record.RecordId())
+	assert.NoError(record.Close())
+	_, _, _, err = r.Next()
+	assert.ErrorIs(err, io.EOF)
+}
+
+// faultyFileSystem wraps a FileSystem and injects errors into selected operations.
+type faultyFileSystem struct {
+	FileSystem
+	openErr   error
+	renameErr error
+	writeErr  error
+	syncErr   error
+}
+
+func (f *faultyFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if f.openErr != nil {
+		return nil, f.openErr
+	}
+	file, err := f.FileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: file, fs: f}, nil
+}
+
+func (f *faultyFileSystem) Rename(oldpath, newpath string) error {
+	if f.renameErr != nil {
+		return f.renameErr
+	}
+	return f.FileSystem.Rename(oldpath, newpath)
+}
+
+type faultyFile struct {
+	File
+	fs *faultyFileSystem
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.fs.writeErr != nil {
+		return 0, f.fs.writeErr
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultyFile) Sync() error {
+	if f.fs.syncErr != nil {
+		return f.fs.syncErr
+	}
+	return f.File.Sync()
+}
+
+func TestWarcFileWriter_rollover(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMemFileSystem()
+
+	nameGenerator := &PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithFileNameGenerator(nameGenerator),
+		WithMaxFileSize(1100))
+
+	wantFiles := []string{"test-0001.warc", "test-0001.warc", "test-0002.warc", "test-0002.warc", "test-0003.warc"}
+	wantOffsets := []int64{0, uncompressedRecordSize, 0, uncompressedRecordSize, 0}
+	for i := range wantFiles {
+		res := w.Write(createTestRecord())
+		assert.NoError(res[0].Err)
+		assert.Equal(wantFiles[i], res[0].FileName)
+		assert.Equal(wantOffsets[i], res[0].FileOffset)
+	}
+	assert.Equal([]string{"test-0001.warc", "test-0002.warc", "test-0003.warc.open"}, m.Names())
+	assert.NoError(w.Close())
+	assert.Equal([]string{"test-0001.warc", "test-0002.warc", "test-0003.warc"}, m.Names())
+}
+
+func TestWarcFileWriter_WithFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.warc.gz"))
+	require.NoError(t, err)
+
+	w := NewWarcFileWriter(
+		WithFile(f),
+		WithMaxFileSize(100),
+		WithMaxConcurrentWriters(4),
+		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}))
+	for i := 0; i < 3; i++ {
+		res := w.Write(createTestRecord())
+		require.NoError(t, res[0].Err)
+		assert.Equal(t, "test.warc.gz", res[0].FileName)
+	}
+	require.NoError(t, w.Close())
+
+	r, err := NewWarcFileReader(f.Name(), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+	var types []RecordType
+	for {
+		record, _, _, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, record.Type())
+		if record.Type() == Warcinfo {
+			assert.Equal(t, "test.warc.gz", record.WarcHeader().Get(WarcFilename))
+		}
+		assert.NoError(t, record.Close())
+	}
+	assert.Equal(t, []RecordType{Warcinfo, Response, Response, Response}, types)
+}
+
+func TestWarcFileWriter_WithFile_rotate(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.warc"))
+	require.NoError(t, err)
+
+	w := NewWarcFileWriter(WithFile(f), WithCompression(false))
+	res := w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Rotate())
+
+	res = w.Write(createTestRecord())
+	assert.ErrorIs(t, res[0].Err, errFileUsed)
+	require.NoError(t, w.Close())
+
+	fi, err := os.Stat(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, int64(uncompressedRecordSize), fi.Size())
+}
+
+func TestWarcFileWriter_fileSystemErrors(t *testing.T) {
+	errInjected := errors.New("injected error")
+
+	tests := []struct {
+		name      string
+		fs        *faultyFileSystem
+		opts      []WarcFileWriterOption
+		wantNames []string
+	}{
+		{"open", &faultyFileSystem{openErr: errInjected}, nil, []string{}},
+		{"write", &faultyFileSystem{writeErr: errInjected}, nil, []string{"test-0001.warc.open"}},
+		{"sync", &faultyFileSystem{syncErr: errInjected}, []WarcFileWriterOption{WithFlush(true)}, []string{"test-0001.warc.open"}},
+		{"warcinfo", &faultyFileSystem{writeErr: errInjected}, []WarcFileWriterOption{WithWarcInfoFunc(func(WarcRecordBuilder) error { return nil })},
+			[]string{"test-0001.warc.open"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			m := NewMemFileSystem()
+			tt.fs.FileSystem = m
+
+			opts := append([]WarcFileWriterOption{
+				WithFileSystem(tt.fs),
+				WithCompression(false),
+				WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+				WithMaxFileSize(0),
+			}, tt.opts...)
+			w := NewWarcFileWriter(opts...)
+
+			res := w.Write(createTestRecord())
+			assert.ErrorIs(res[0].Err, errInjected)
+			assert.NoError(w.Close())
+			assert.Equal(tt.wantNames, m.Names())
+		})
+	}
+}
+
+func TestWarcFileWriter_renameError(t *testing.T) {
+	assert := assert.New(t)
+	errInjected := errors.New("injected error")
+	m := NewMemFileSystem()
+	f := &faultyFileSystem{FileSystem: m, renameErr: errInjected}
+
+	w := NewWarcFileWriter(
+		WithFileSystem(f),
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(0))
+
+	res := w.Write(createTestRecord())
+	assert.NoError(res[0].Err)
+	assert.ErrorIs(w.Rotate(), errInjected)
+	assert.NoError(w.Close())
+
+	// The file is complete, but never lost its open file suffix
+	assert.Equal([]string{"test-0001.warc.open"}, m.Names())
+}
+
+func TestWarcFileWriter_crash(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMemFileSystem()
+	f := &faultyFileSystem{FileSystem: m}
+
+	w := NewWarcFileWriter(
+		WithFileSystem(f),
+		WithCompression(true),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(800))
+
+	for i := 0; i < 3; i++ {
+		res := w.Write(createTestRecord())
+		assert.NoError(res[0].Err)
+	}
+
+	// Simulate a crash in the middle of writing a record, then continue writing
+	f.writeErr = errors.New("injected error")
+	res := w.Write(createTestRecord())
+	assert.Error(res[0].Err)
+	f.writeErr = nil
+	res = w.Write(createTestRecord())
+	assert.NoError(res[0].Err)
+	assert.NoError(w.Close())
+
+	// The only anomaly should be the abandoned file with open file suffix
+	assert.Equal([]string{"test-0001.warc.gz", "test-0002.warc.gz.open", "test-0003.warc.gz"}, m.Names())
+	for _, name := range []string{"test-0001.warc.gz", "test-0003.warc.gz"} {
+		b, err := m.ReadFile(name)
+		require.NoError(t, err)
+		r, err := NewWarcFileReaderFromStream(bytes.NewReader(b), 0, WithStrictValidation())
+		require.NoError(t, err)
+		for {
+			record, _, _, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err, name)
+			assert.NoError(record.Close())
+		}
+		assert.NoError(r.Close())
+	}
+}
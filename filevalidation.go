@@ -0,0 +1,281 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+)
+
+// ReferenceError is used when a record references another record which could not be found.
+type ReferenceError struct {
+	Offset      int64  // Offset of the referencing record
+	FieldName   string // Name of the header field holding the reference
+	ReferenceId string // The referenced WARC-Record-ID
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("gowarc: record at offset %d: %s references missing record %s", e.Offset, e.FieldName, e.ReferenceId)
+}
+
+// ErrNoContentRecords is reported by [ValidateFile] for a WARC file without any records other than warcinfo records.
+// Such a file is valid according to the WARC specification, but is usually the result of a failed capture.
+var ErrNoContentRecords = errors.New("gowarc: no records other than warcinfo in file")
+
+// ValidateFile reads every record in the WARC file and validates it.
+//
+// In addition to the record level validation done by [WarcFileReader.Next], references between records are checked.
+// A WARC-Concurrent-To field, or the WARC-Refers-To field of a conversion record, referencing a record which is not
+// present in the file is reported as a [ReferenceError]. A file which is empty or only holds warcinfo records is
+// reported with [ErrNoContentRecords].
+// Use [FindDuplicates] to look for records which have been written more than once.
+//
+// Record level validation errors are wrapped with the offset of the record. An error is returned if the file could
+// not be read or if a record fails validation according to the supplied options.
+func ValidateFile(filename string, opts ...WarcRecordOption) (*Validation, error) {
+	r, err := NewWarcFileReader(filename, 0, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	validation := &Validation{}
+	ids := make(map[string]bool)
+	type reference struct {
+		offset int64
+		field  string
+		id     string
+	}
+	var references []reference
+	contentRecords := 0
+
+	for {
+		record, offset, v, err := r.Next()
+		if v != nil {
+			for _, e := range *v {
+				validation.addError(fmt.Errorf("record at offset %d: %w", offset, e))
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if record != nil {
+				_ = record.Close()
+			}
+			return validation, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+
+		ids[record.WarcHeader().Get(WarcRecordID)] = true
+		if record.Type() != Warcinfo {
+			contentRecords++
+		}
+		for _, id := range record.WarcHeader().GetAll(WarcConcurrentTo) {
+			references = append(references, reference{offset, WarcConcurrentTo, id})
+		}
+		if record.Type() == Conversion && record.WarcHeader().Has(WarcRefersTo) {
+			references = append(references, reference{offset, WarcRefersTo, record.WarcHeader().Get(WarcRefersTo)})
+		}
+
+		if err := record.Close(); err != nil {
+			return validation, err
+		}
+	}
+
+	for _, ref := range references {
+		if !ids[ref.id] {
+			validation.addError(&ReferenceError{Offset: ref.offset, FieldName: ref.field, ReferenceId: ref.id})
+		}
+	}
+	if contentRecords == 0 {
+		validation.addError(ErrNoContentRecords)
+	}
+	return validation, nil
+}
+
+// ValidateRecord validates a record the way it would be read after being written to a WARC file.
+//
+// The record is marshaled with the default [Marshaler] and parsed again with an [Unmarshaler] configured with opts, so
+// the result is the same as for reading the record from a file, including the checks of mandatory fields,
+// Content-Length and digests. Nothing is written to disk. The block is cached first, so the record can still be
+// written after it is validated.
+//
+// An error is returned if the record can't be marshaled or if it fails validation according to the supplied options.
+func ValidateRecord(record WarcRecord, opts ...WarcRecordOption) (*Validation, error) {
+	if err := record.Block().Cache(); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, _, err := NewMarshaler().Marshal(pw, record, 0)
+		_ = pw.CloseWithError(err)
+	}()
+
+	parsed, _, validation, err := NewUnmarshaler(opts...).Unmarshal(bufio.NewReader(pr))
+	if parsed != nil {
+		_ = parsed.Close()
+	}
+	// Drain the pipe to let the marshaler finish and pick up its error, if any
+	if _, copyErr := io.Copy(io.Discard, pr); copyErr != nil {
+		return validation, copyErr
+	}
+	return validation, err
+}
+
+// Duplicate describes a header field value which occurs in more than one record in a WARC file.
+type Duplicate struct {
+	FieldName string  // Name of the header field, either WARC-Record-ID or WARC-Payload-Digest
+	Value     string  // The duplicated value
+	Offsets   []int64 // Offsets of the records having the value
+}
+
+// FindDuplicates reads every record in the WARC file and reports records with the same WARC-Record-ID and records with
+// the same WARC-Payload-Digest.
+//
+// Revisit records are expected to repeat the payload digest of the record they revisit and are not considered when
+// looking for duplicated payload digests. The duplicates are returned in the order they are detected.
+//
+// By default every value is kept in memory, so the memory used grows linearly with the number of records. Use
+// [WithDuplicateFilter] to bound the memory for huge files at the cost of reading the file twice.
+func FindDuplicates(filename string, opts ...WarcRecordOption) ([]*Duplicate, error) {
+	o := newOptions(opts...)
+
+	// candidates holds the values which might be duplicated. All values are candidates if it is nil.
+	var candidates map[duplicateKey]bool
+	if o.duplicateFilterSize > 0 {
+		filter := newBloomFilter(o.duplicateFilterSize, o.duplicateFilterRate)
+		candidates = make(map[duplicateKey]bool)
+		err := forEachDuplicateKey(filename, opts, func(k duplicateKey, _ int64) {
+			if filter.add(k.field + "\x00" + k.value) {
+				candidates[k] = true
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	firstOffset := make(map[duplicateKey]int64)
+	duplicates := make(map[duplicateKey]*Duplicate)
+	var result []*Duplicate
+	err := forEachDuplicateKey(filename, opts, func(k duplicateKey, offset int64) {
+		if candidates != nil && !candidates[k] {
+			return
+		}
+		first, seen := firstOffset[k]
+		if !seen {
+			firstOffset[k] = offset
+			return
+		}
+		if d, ok := duplicates[k]; ok {
+			d.Offsets = append(d.Offsets, offset)
+			return
+		}
+		d := &Duplicate{FieldName: k.field, Value: k.value, Offsets: []int64{first, offset}}
+		duplicates[k] = d
+		result = append(result, d)
+	})
+	return result, err
+}
+
+// duplicateKey is a header field value checked by FindDuplicates.
+type duplicateKey struct{ field, value string }
+
+// forEachDuplicateKey calls fn with the WARC-Record-ID and, except for revisit records, the WARC-Payload-Digest of
+// every record in the WARC file. Empty values are skipped.
+func forEachDuplicateKey(filename string, opts []WarcRecordOption, fn func(k duplicateKey, offset int64)) error {
+	r, err := NewWarcFileReader(filename, 0, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	for {
+		record, offset, _, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if record != nil {
+				_ = record.Close()
+			}
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+
+		if v := record.WarcHeader().Get(WarcRecordID); v != "" {
+			fn(duplicateKey{WarcRecordID, v}, offset)
+		}
+		if v := record.WarcHeader().Get(WarcPayloadDigest); v != "" && record.Type() != Revisit {
+			fn(duplicateKey{WarcPayloadDigest, v}, offset)
+		}
+
+		if err := record.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+// bloomFilter is a space-efficient set which might report a value as present when it is not, but never the other way
+// around.
+type bloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes int
+}
+
+// newBloomFilter returns a bloomFilter sized for n values with the false positive rate p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	if p <= 0 || p >= 1 {
+		p = defaultDuplicateFilterRate
+	}
+	size := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if size < 64 {
+		size = 64
+	}
+	hashes := int(math.Round(float64(size) / float64(n) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (size+63)/64), size: size, hashes: hashes}
+}
+
+// add adds s to the filter and returns true if s might have been added before.
+func (f *bloomFilter) add(s string) bool {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	h1 := h.Sum64()
+	h = fnv.New64()
+	_, _ = h.Write([]byte(s))
+	// An odd step visits different bits for each hash function
+	h2 := h.Sum64() | 1
+
+	present := true
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.size
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if f.bits[word]&mask == 0 {
+			present = false
+			f.bits[word] |= mask
+		}
+	}
+	return present
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFile writes the records to a new uncompressed WARC file in dir and returns the path of the file.
+func writeTestFile(t *testing.T, dir string, records ...WarcRecord) string {
+	t.Helper()
+	nameGenerator := &PatternNameGenerator{Directory: dir, Pattern: "test-%04{serial}d.warc"}
+	w := NewWarcFileWriter(
+		WithCompression(false),
+		WithFileNameGenerator(nameGenerator),
+		WithMaxFileSize(0))
+	var fileName string
+	for _, r := range records {
+		res := w.Write(r)
+		require.NoError(t, res[0].Err)
+		fileName = res[0].FileName
+	}
+	require.NoError(t, w.Close())
+	return filepath.Join(dir, fileName)
+}
+
+func TestValidateFile(t *testing.T) {
+	req := createTestRecord()
+	req.WarcHeader().Set(WarcRecordID, "<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>")
+	resp := createTestRecord()
+	resp.WarcHeader().Set(WarcRecordID, "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>")
+	LinkConcurrentRecords(req, resp)
+	orphan := createTestRecord()
+	orphan.WarcHeader().Set(WarcRecordID, "<urn:uuid:cccccccc-0221-11e7-adb1-0242ac120008>")
+	orphan.WarcHeader().AddId(WarcConcurrentTo, "urn:uuid:dddddddd-0221-11e7-adb1-0242ac120008")
+
+	path := writeTestFile(t, t.TempDir(), req, resp, orphan)
+
+	validation, err := ValidateFile(path)
+	require.NoError(t, err)
+	require.Len(t, *validation, 1)
+
+	var refErr *ReferenceError
+	require.True(t, errors.As((*validation)[0], &refErr))
+	assert.Equal(t, WarcConcurrentTo, refErr.FieldName)
+	assert.Equal(t, "<urn:uuid:dddddddd-0221-11e7-adb1-0242ac120008>", refErr.ReferenceId)
+	assert.Greater(t, refErr.Offset, int64(0))
+}
+
+func TestValidateFile_conversion(t *testing.T) {
+	original := createTestRecord()
+	original.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+
+	newConversion := func(refersTo WarcRecord) WarcRecord {
+		rb := NewConversionRecord(refersTo)
+		rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+		rb.AddWarcHeader(ContentType, "text/plain")
+		_, err := rb.WriteString("converted")
+		require.NoError(t, err)
+		record, _, err := rb.Build()
+		require.NoError(t, err)
+		return record
+	}
+	conversion := newConversion(original)
+	missing := createTestRecord()
+	missing.WarcHeader().Set(WarcRecordID, "<urn:uuid:dddddddd-0221-11e7-adb1-0242ac120008>")
+	orphan := newConversion(missing)
+
+	path := writeTestFile(t, t.TempDir(), original, conversion, orphan)
+
+	validation, err := ValidateFile(path)
+	require.NoError(t, err)
+	require.Len(t, *validation, 1)
+
+	var refErr *ReferenceError
+	require.True(t, errors.As((*validation)[0], &refErr))
+	assert.Equal(t, WarcRefersTo, refErr.FieldName)
+	assert.Equal(t, "<urn:uuid:dddddddd-0221-11e7-adb1-0242ac120008>", refErr.ReferenceId)
+}
+
+func TestValidateFile_noContentRecords(t *testing.T) {
+	rb := NewRecordBuilder(Warcinfo)
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.AddWarcHeader(ContentType, ApplicationWarcFields)
+	_, err := rb.WriteString("software: test\r\n")
+	require.NoError(t, err)
+	warcinfo, _, err := rb.Build()
+	require.NoError(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.warc")
+	require.NoError(t, os.WriteFile(empty, nil, 0644))
+
+	for name, path := range map[string]string{
+		"empty":         empty,
+		"only warcinfo": writeTestFile(t, t.TempDir(), warcinfo),
+	} {
+		t.Run(name, func(t *testing.T) {
+			validation, err := ValidateFile(path)
+			require.NoError(t, err)
+			require.Len(t, *validation, 1)
+			assert.ErrorIs(t, (*validation)[0], ErrNoContentRecords)
+		})
+	}
+}
+
+func TestValidateRecord(t *testing.T) {
+	record := createTestRecord()
+	validation, err := ValidateRecord(record)
+	require.NoError(t, err)
+	assert.True(t, validation.Valid(), validation.String())
+
+	// The record can still be written
+	res := NewWarcFileWriter(WithFileSystem(NewMemFileSystem()), WithCompression(false)).Write(record)
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, int64(uncompressedRecordSize), res[0].BytesWritten)
+
+	record = createTestRecord()
+	record.WarcHeader().Set(WarcBlockDigest, "sha1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+	validation, err = ValidateRecord(record)
+	require.NoError(t, err)
+	require.Len(t, *validation, 1)
+	assert.ErrorContains(t, (*validation)[0], "block: wrong digest")
+
+	record = createTestRecord()
+	record.WarcHeader().Delete(WarcDate)
+	_, err = ValidateRecord(record, WithStrictValidation())
+	assert.ErrorContains(t, err, "missing required field: WARC-Date")
+}
+
+func TestFindDuplicates(t *testing.T) {
+	r1 := createTestRecord()
+	r1.WarcHeader().Set(WarcPayloadDigest, "sha1:AAAA")
+	r2 := createTestRecord()
+	r2.WarcHeader().Set(WarcRecordID, "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>")
+	r2.WarcHeader().Set(WarcPayloadDigest, "sha1:AAAA")
+	r3 := createTestRecord()
+	r3.WarcHeader().Set(WarcPayloadDigest, "sha1:BBBB")
+	r4 := createTestRecord()
+
+	path := writeTestFile(t, t.TempDir(), r1, r2, r3, r4)
+
+	duplicates, err := FindDuplicates(path, WithNoValidation())
+	require.NoError(t, err)
+	require.Len(t, duplicates, 2)
+
+	assert.Equal(t, WarcPayloadDigest, duplicates[0].FieldName)
+	assert.Equal(t, "sha1:AAAA", duplicates[0].Value)
+	// r1 is longer than the test record by the added "WARC-Payload-Digest: sha1:AAAA\r\n" line
+	assert.Equal(t, []int64{0, uncompressedRecordSize + 32}, duplicates[0].Offsets)
+
+	assert.Equal(t, WarcRecordID, duplicates[1].FieldName)
+	assert.Equal(t, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>", duplicates[1].Value)
+	assert.Len(t, duplicates[1].Offsets, 3)
+
+	// The bloom filter gives the same result, also when it is too small to avoid false positives
+	for _, size := range []int{100, 1} {
+		filtered, err := FindDuplicates(path, WithNoValidation(), WithDuplicateFilter(size, 0.01))
+		require.NoError(t, err)
+		assert.Equal(t, duplicates, filtered, "size %d", size)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	f := newBloomFilter(1000, 0.01)
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if f.add(fmt.Sprintf("value-%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 50)
+	for i := 0; i < 1000; i++ {
+		assert.True(t, f.add(fmt.Sprintf("value-%d", i)))
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FtpControlBlock is the block of a record holding an FTP control conversation, i.e. a record with the content type
+// text/x-ftp-control-conversation.
+//
+// The conversation consists of the commands sent by the client and the replies from the server, one per line.
+type FtpControlBlock interface {
+	Block
+	// Lines returns the lines of the conversation in the order they were sent.
+	Lines() []FtpControlLine
+}
+
+// FtpControlLine is a line in an FTP control conversation.
+//
+// A line starting with a three digit code is a reply from the server, other lines are commands sent by the client.
+// For a command, Command holds the command name, e.g. RETR, and Text holds the arguments.
+type FtpControlLine struct {
+	Reply   bool
+	Code    int
+	Command string
+	Text    string
+}
+
+type ftpControlBlock struct {
+	bufferedBlock
+	lines []FtpControlLine
+}
+
+func (block *ftpControlBlock) Lines() []FtpControlLine {
+	return block.lines
+}
+
+func newFtpControlBlock(opts *warcRecordOptions, rb io.Reader, d *digest, validation *Validation) (FtpControlBlock, error) {
+	block := &ftpControlBlock{bufferedBlock: bufferedBlock{blockDigest: d}}
+	if err := block.readContent(opts, rb, validation); err != nil {
+		return block, err
+	}
+
+	scanner := bufio.NewScanner(block.content.Slice(0, 0))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		block.lines = append(block.lines, parseFtpControlLine(line))
+	}
+	if err := scanner.Err(); err != nil {
+		switch opts.errBlock {
+		case ErrWarn:
+			validation.addError(newWrappedSyntaxError("error in ftp control block", &position{}, err))
+		case ErrFail:
+			return block, newWrappedSyntaxError("error in ftp control block", &position{}, err)
+		}
+	}
+	return block, nil
+}
+
+// parseFtpControlLine parses a line of an FTP control conversation. A reply is a three digit code followed by a space
+// or, for the lines of a multiline reply, a hyphen.
+func parseFtpControlLine(line string) FtpControlLine {
+	if len(line) >= 3 && (len(line) == 3 || line[3] == ' ' || line[3] == '-') {
+		if code, err := strconv.Atoi(line[:3]); err == nil && code >= 100 {
+			text := ""
+			if len(line) > 4 {
+				text = line[4:]
+			}
+			return FtpControlLine{Reply: true, Code: code, Text: text}
+		}
+	}
+	command, text, _ := strings.Cut(line, " ")
+	return FtpControlLine{Command: strings.ToUpper(command), Text: text}
+}
@@ -20,10 +20,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/nlnwa/whatwg-url/url"
+	"mime"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -53,6 +55,10 @@ const (
 	WarcPageID                = "WARC-Page-ID"       // Browsertrix extension field
 	WarcResourceType          = "WARC-Resource-Type" // Browsertrix extension field
 	WarcJSONMetadata          = "WARC-JSON-Metadata" // Browsertrix extension field
+	WarcProtocol              = "WARC-Protocol"      // Proposed WARC 1.1 extension field
+	WarcCipherSuite           = "WARC-Cipher-Suite"  // Proposed WARC 1.1 extension field
+	WarcSourceURI             = "WARC-Source-URI"    // Proposed WARC 1.1 extension field
+	WarcCreationDate          = "WARC-Creation-Date" // Proposed WARC 1.1 extension field
 )
 
 // validateHeader validates a WarcFields object as a WARC-record header
@@ -62,12 +68,32 @@ func validateHeader(wf *WarcFields, version *WarcVersion, validation *Validation
 		return rt, err
 	}
 
+	switch opts.unknownHeader {
+	case UnknownHeaderWarn:
+		for _, nv := range *wf {
+			if name, def := normalizeName(nv.Name); def.name == "" {
+				validation.addError(newHeaderFieldError(name, "unknown field"))
+			}
+		}
+	case UnknownHeaderDrop:
+		result := (*wf)[:0]
+		for _, nv := range *wf {
+			if _, def := normalizeName(nv.Name); def.name != "" {
+				result = append(result, nv)
+			}
+		}
+		*wf = result
+	}
+
 	if opts.errSpec > ErrIgnore {
+		duplicates := make(map[string]bool)
 		for _, nv := range *wf {
 			name, def := normalizeName(nv.Name)
 			value, err := def.validationFunc(opts, name, nv.Value, version, rt, def)
 			nv.Name = name
-			nv.Value = value
+			if err == nil || !opts.keepInvalidValues {
+				nv.Value = value
+			}
 			if err != nil {
 				switch opts.errSpec {
 				case ErrWarn:
@@ -77,7 +103,9 @@ func validateHeader(wf *WarcFields, version *WarcVersion, validation *Validation
 				}
 			}
 
-			if !def.repeatable && len(wf.GetAll(name)) > 1 {
+			// Report a duplicated single-valued field only once
+			if !def.repeatable && !duplicates[name] && len(wf.GetAll(name)) > 1 {
+				duplicates[name] = true
 				switch opts.errSpec {
 				case ErrWarn:
 					validation.addError(newHeaderFieldError(name, "field occurs more than once"))
@@ -192,7 +220,7 @@ var fieldDefs = []fieldDef{
 	{WarcIPAddress, pIp, false,
 		Response | Resource | Request | Metadata | Revisit,
 		V1_0.id | V1_1.id},
-	{WarcIdentifiedPayloadType, pString, false,
+	{WarcIdentifiedPayloadType, pMediaType, false,
 		Warcinfo | Response | Resource | Request | Metadata | Revisit | Conversion | Continuation,
 		V1_0.id | V1_1.id},
 	{WarcPayloadDigest, pDigest, false,
@@ -243,6 +271,18 @@ var fieldDefs = []fieldDef{
 	{WarcJSONMetadata, pString, false,
 		Response | Resource | Request | Metadata | Revisit | Conversion | Continuation,
 		0}, // Browsertrix extension field
+	{WarcProtocol, pToken, true,
+		Response | Resource | Request | Metadata | Revisit,
+		V1_1.id}, // Proposed WARC 1.1 extension field
+	{WarcCipherSuite, pToken, false,
+		Response | Resource | Request | Metadata | Revisit,
+		V1_1.id}, // Proposed WARC 1.1 extension field
+	{WarcSourceURI, pURI, false,
+		Warcinfo | Response | Resource | Request | Metadata | Revisit | Conversion | Continuation,
+		V1_0.id | V1_1.id}, // Proposed WARC 1.1 extension field
+	{WarcCreationDate, pTime, false,
+		Warcinfo | Response | Resource | Request | Metadata | Revisit | Conversion | Continuation,
+		V1_0.id | V1_1.id}, // Proposed WARC 1.1 extension field
 }
 
 // Map lower case header name to field definition
@@ -254,11 +294,50 @@ func init() {
 	}
 }
 
+// Map lower case header name to definition of fields registered with RegisterHeaderField
+var (
+	customFieldsMu  sync.RWMutex
+	customFieldDefs = make(map[string]fieldDef)
+)
+
+// RegisterHeaderField registers name as a custom WARC header field, e.g. a field used by a crawler for linking the
+// records belonging to the same page.
+//
+// Unknown fields are normalized to title case, e.g. WARC-Crawl-ID is written as Warc-Crawl-Id. A registered field is
+// spelled exactly as name instead. It is also treated as a known field by the policy set with
+// [WithUnknownHeaderPolicy], so it is neither reported by UnknownHeaderWarn nor removed by UnknownHeaderDrop. The field
+// is allowed in all record types and might be repeated. The value is not validated.
+//
+// Registering a field defined by this package has no effect. An error is returned if name is not a valid field name.
+// Fields should be registered before records using them are read or created, e.g. in an init function.
+func RegisterHeaderField(name string) error {
+	if !isFieldName(name) {
+		return fmt.Errorf("gowarc: illegal header field name: '%s'", name)
+	}
+	lcName := strings.ToLower(name)
+	if _, ok := lcHdrNameToDef[lcName]; ok {
+		return nil
+	}
+
+	customFieldsMu.Lock()
+	defer customFieldsMu.Unlock()
+	customFieldDefs[lcName] = fieldDef{name, pUnknown, true,
+		Warcinfo | Response | Resource | Request | Metadata | Revisit | Conversion | Continuation,
+		V1_0.id | V1_1.id}
+	return nil
+}
+
 func normalizeName(name string) (string, fieldDef) {
 	lcName := strings.ToLower(name)
 	if f, ok := lcHdrNameToDef[lcName]; ok {
 		return f.name, f
 	}
+	customFieldsMu.RLock()
+	f, ok := customFieldDefs[lcName]
+	customFieldsMu.RUnlock()
+	if ok {
+		return f.name, f
+	}
 	return http.CanonicalHeaderKey(name), lcHdrNameToDef[""]
 }
 
@@ -342,12 +421,32 @@ var (
 		}
 		return value, nil
 	}
+	pMediaType = func(opts *warcRecordOptions, name, value string, version *WarcVersion, recordType RecordType, def fieldDef) (string, error) {
+		if shouldValidate, err := checkLegal(opts, name, version, recordType, def); err != nil {
+			return "", err
+		} else if shouldValidate {
+			if _, _, err := mime.ParseMediaType(value); err != nil {
+				return "", fmt.Errorf("illegal media type: '%s'", value)
+			}
+		}
+		return value, nil
+	}
 	pDigest = func(opts *warcRecordOptions, name, value string, version *WarcVersion, recordType RecordType, def fieldDef) (string, error) {
 		if _, err := checkLegal(opts, name, version, recordType, def); err != nil {
 			return "", err
 		}
 		return value, nil
 	}
+	pToken = func(opts *warcRecordOptions, name, value string, version *WarcVersion, recordType RecordType, def fieldDef) (string, error) {
+		if shouldValidate, err := checkLegal(opts, name, version, recordType, def); err != nil {
+			return "", err
+		} else if shouldValidate {
+			if value == "" || strings.IndexFunc(value, func(r rune) bool { return r <= ' ' || r >= 0x7f }) >= 0 {
+				return "", fmt.Errorf("illegal token: '%s'", value)
+			}
+		}
+		return value, nil
+	}
 	pTruncReason = func(opts *warcRecordOptions, name, value string, version *WarcVersion, recordType RecordType, def fieldDef) (string, error) {
 		if _, err := checkLegal(opts, name, version, recordType, def); err != nil {
 			return "", err
@@ -19,6 +19,7 @@ package gowarc
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -96,6 +97,37 @@ func TestValidateHeader(t *testing.T) {
 			nil,
 			errors.New("gowarc: illegal field 'WARC-Filename' in record type 'resource' at header WARC-Filename"),
 		},
+		{
+			"Duplicated single-valued field is reported once",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2017-12-06T04:03:53Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+				&nameValue{Name: WarcType, Value: "resource"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: ContentType, Value: "text/plain"},
+				&nameValue{Name: WarcTargetURI, Value: "http://www.example.com/1"},
+				&nameValue{Name: WarcTargetURI, Value: "http://www.example.com/2"},
+				&nameValue{Name: WarcTargetURI, Value: "http://www.example.com/3"},
+			},
+			newOptions(),
+			nil,
+			errors.New("gowarc: field occurs more than once at header WARC-Target-URI"),
+		},
+		{
+			"Repeated multi-valued field",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2017-12-06T04:03:53Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+				&nameValue{Name: WarcType, Value: "response"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: ContentType, Value: "application/http; msgtype=response"},
+				&nameValue{Name: WarcConcurrentTo, Value: "<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>"},
+				&nameValue{Name: WarcConcurrentTo, Value: "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>"},
+			},
+			newOptions(WithSpecViolationPolicy(ErrFail)),
+			nil,
+			nil,
+		},
 		{
 			"Browsertrix extension fields",
 			&WarcFields{
@@ -114,6 +146,92 @@ func TestValidateHeader(t *testing.T) {
 			nil,
 			nil,
 		},
+		{
+			"TLS extension fields",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2024-03-17T16:26:51Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:d3aae465-714f-4aa8-8f1b-23e75b09af42>"},
+				&nameValue{Name: WarcType, Value: "response"},
+				&nameValue{Name: ContentType, Value: "application/http; msgtype=response"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: "warc-protocol", Value: "h2"},
+				&nameValue{Name: "warc-protocol", Value: "tls/1.3"},
+				&nameValue{Name: "warc-cipher-suite", Value: "TLS_AES_128_GCM_SHA256"},
+			},
+			newOptions(WithSpecViolationPolicy(ErrFail)),
+			nil,
+			nil,
+		},
+		{
+			"Unknown field is kept silently by default",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2017-12-06T04:03:53Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+				&nameValue{Name: WarcType, Value: "resource"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: ContentType, Value: "text/plain"},
+				&nameValue{Name: "X-Crawler-Id", Value: "42"},
+			},
+			newOptions(WithSpecViolationPolicy(ErrFail)),
+			nil,
+			nil,
+		},
+		{
+			"Unknown field with warn policy",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2017-12-06T04:03:53Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+				&nameValue{Name: WarcType, Value: "resource"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: ContentType, Value: "text/plain"},
+				&nameValue{Name: "x-crawler-id", Value: "42"},
+			},
+			newOptions(WithUnknownHeaderPolicy(UnknownHeaderWarn)),
+			nil,
+			errors.New("gowarc: unknown field at header X-Crawler-Id"),
+		},
+		{
+			"Illegal WARC-Cipher-Suite",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2024-03-17T16:26:51Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:d3aae465-714f-4aa8-8f1b-23e75b09af42>"},
+				&nameValue{Name: WarcType, Value: "response"},
+				&nameValue{Name: ContentType, Value: "application/http; msgtype=response"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: WarcCipherSuite, Value: "TLS AES"},
+			},
+			newOptions(),
+			nil,
+			errors.New("gowarc: illegal token: 'TLS AES' at header WARC-Cipher-Suite"),
+		},
+		{
+			"Valid WARC-Identified-Payload-Type",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2017-12-06T04:03:53Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+				&nameValue{Name: WarcType, Value: "response"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: ContentType, Value: "application/http; msgtype=response"},
+				&nameValue{Name: WarcIdentifiedPayloadType, Value: "image/png"},
+			},
+			newOptions(WithUnknownHeaderPolicy(UnknownHeaderWarn)),
+			nil,
+			nil,
+		},
+		{
+			"Illegal WARC-Identified-Payload-Type",
+			&WarcFields{
+				&nameValue{Name: WarcDate, Value: "2017-12-06T04:03:53Z"},
+				&nameValue{Name: WarcRecordID, Value: "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+				&nameValue{Name: WarcType, Value: "response"},
+				&nameValue{Name: ContentLength, Value: "249"},
+				&nameValue{Name: ContentType, Value: "application/http; msgtype=response"},
+				&nameValue{Name: WarcIdentifiedPayloadType, Value: "image png"},
+			},
+			newOptions(),
+			nil,
+			errors.New("gowarc: illegal media type: 'image png' at header WARC-Identified-Payload-Type"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -153,6 +271,66 @@ func TestValidateHeader(t *testing.T) {
 	}
 }
 
+func TestValidateHeader_dropUnknown(t *testing.T) {
+	wf := &WarcFields{
+		&nameValue{Name: WarcDate, Value: "2017-12-06T04:03:53Z"},
+		&nameValue{Name: "X-Crawler-Id", Value: "42"},
+		&nameValue{Name: WarcRecordID, Value: "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+		&nameValue{Name: WarcType, Value: "resource"},
+		&nameValue{Name: "X-Crawler-Host", Value: "crawler1"},
+		&nameValue{Name: ContentLength, Value: "249"},
+		&nameValue{Name: ContentType, Value: "text/plain"},
+	}
+	validation := &Validation{}
+	_, err := validateHeader(wf, V1_1, validation, newOptions(WithUnknownHeaderPolicy(UnknownHeaderDrop)))
+	if err != nil {
+		t.Fatalf("validateHeader() unexpected error = %v", err)
+	}
+	if !validation.Valid() {
+		t.Errorf("validateHeader() unexpected validation error = %v", validation)
+	}
+	if len(*wf) != 5 || wf.Has("X-Crawler-Id") || wf.Has("X-Crawler-Host") {
+		t.Errorf("validateHeader() unknown fields not dropped: %v", wf)
+	}
+}
+
+func TestRegisterHeaderField(t *testing.T) {
+	if err := RegisterHeaderField("WARC-Test-Page-ID"); err != nil {
+		t.Fatalf("RegisterHeaderField() unexpected error = %v", err)
+	}
+	if err := RegisterHeaderField("WARC-Test:Page"); err == nil {
+		t.Errorf("RegisterHeaderField() expected error for illegal name")
+	}
+	if name, _ := normalizeName("warc-test-page-id"); name != "WARC-Test-Page-ID" {
+		t.Errorf("normalizeName() = %v, want %v", name, "WARC-Test-Page-ID")
+	}
+
+	for _, policy := range []unknownHeaderPolicy{UnknownHeaderWarn, UnknownHeaderDrop} {
+		wf := &WarcFields{}
+		wf.Add(WarcDate, "2017-12-06T04:03:53Z")
+		wf.Add(WarcRecordID, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+		wf.Add(WarcType, "resource")
+		wf.Add(ContentLength, "249")
+		wf.Add(ContentType, "text/plain")
+		wf.Add("warc-test-page-id", "page-1")
+		wf.Add("WARC-Test-Page-ID", "page-2")
+		validation := &Validation{}
+		_, err := validateHeader(wf, V1_1, validation, newOptions(WithUnknownHeaderPolicy(policy), WithStrictValidation()))
+		if err != nil {
+			t.Fatalf("validateHeader() unexpected error = %v", err)
+		}
+		if !validation.Valid() {
+			t.Errorf("validateHeader() unexpected validation error = %v", validation)
+		}
+		if got := wf.GetAll("Warc-Test-Page-Id"); len(got) != 2 || got[0] != "page-1" || got[1] != "page-2" {
+			t.Errorf("validateHeader() registered field not kept: %v", wf)
+		}
+		if !strings.Contains(wf.String(), "WARC-Test-Page-ID: page-1") {
+			t.Errorf("registered field not spelled as registered: %v", wf)
+		}
+	}
+}
+
 func TestNormalizeName(t *testing.T) {
 	type test struct {
 		name string
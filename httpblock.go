@@ -34,6 +34,11 @@ type HttpRequestBlock interface {
 	HttpHeader() *http.Header
 }
 
+// HttpResponseBlock is the block of a record holding an HTTP response.
+//
+// The status line and headers are parsed when the record is read, while the payload is left unread until it is
+// accessed. HttpStatusCode and HttpHeader are therefore cheap, e.g. for indexing the status code and Content-Type.
+// If the headers could not be parsed, HttpStatusCode returns 0 and HttpHeader returns nil.
 type HttpResponseBlock interface {
 	PayloadBlock
 	ProtocolHeaderBlock
@@ -46,3 +46,44 @@ func Sprintt(format string, params map[string]interface{}) string {
 	}
 	return fmt.Sprintf(format, args...)
 }
+
+// NamedVerb is a verb with a named parameter in a format accepted by Sprintt.
+type NamedVerb struct {
+	Name string // Name of the parameter
+	Verb byte   // The verb, e.g. 's' or 'd'
+}
+
+// ParseNamedVerbs returns the verbs in a format accepted by Sprintt.
+//
+// An error is returned if a verb is malformed or does not reference a named parameter.
+func ParseNamedVerbs(format string) ([]NamedVerb, error) {
+	var verbs []NamedVerb
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		start := i
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		// Skip flags, width and precision
+		for i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) || format[i] != '{' {
+			return nil, fmt.Errorf("missing parameter name in verb at position %d", start)
+		}
+		end := strings.IndexByte(format[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated parameter name in verb at position %d", start)
+		}
+		name := format[i+1 : i+end]
+		i += end + 1
+		if i >= len(format) || !(format[i] >= 'a' && format[i] <= 'z' || format[i] >= 'A' && format[i] <= 'Z') {
+			return nil, fmt.Errorf("missing verb for parameter '%s' at position %d", name, start)
+		}
+		verbs = append(verbs, NamedVerb{Name: name, Verb: format[i]})
+	}
+	return verbs, nil
+}
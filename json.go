@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// MarshalJSON implements json.Marshaler. The block content is not included, see [RecordToJSON].
+func (wr *warcRecord) MarshalJSON() ([]byte, error) {
+	return RecordToJSON(wr, 0)
+}
+
+// RecordToJSON returns a JSON representation of the record suitable for logging and debugging, e.g.
+//
+//	{"version":"WARC/1.1","header":{"WARC-Type":"resource",...},"block":{"type":"generic","length":7,"digest":"sha1:..."}}
+//
+// The header is an object with the field names in the order of the record. The value of a repeated field is an array.
+// The block is summarized with its type, length and digest as given by the header. If the block is text of at most
+// maxInlineSize bytes, the content is included as well. The block is cached to be able to read it more than once.
+func RecordToJSON(record WarcRecord, maxInlineSize int64) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"version":`)
+	writeJSONString(buf, record.Version().String())
+	buf.WriteString(`,"header":{`)
+	for i, name := range record.WarcHeader().Names() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, name)
+		buf.WriteByte(':')
+		values := record.WarcHeader().GetAll(name)
+		if len(values) == 1 {
+			writeJSONString(buf, values[0])
+			continue
+		}
+		buf.WriteByte('[')
+		for j, v := range values {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, v)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteString(`},"block":`)
+
+	block := struct {
+		Type    string  `json:"type"`
+		Length  int64   `json:"length"`
+		Digest  string  `json:"digest,omitempty"`
+		Content *string `json:"content,omitempty"`
+	}{
+		Type:   blockTypeName(record.Block()),
+		Digest: record.WarcHeader().Get(WarcBlockDigest),
+	}
+	block.Length, _ = record.ContentLength()
+	if maxInlineSize > 0 && block.Length <= maxInlineSize && isTextContent(record.WarcHeader().Get(ContentType)) {
+		content, err := readBlockContent(record.Block())
+		if err != nil {
+			return nil, err
+		}
+		if utf8.Valid(content) {
+			s := string(content)
+			block.Content = &s
+		}
+	}
+	b, err := json.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(b)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// blockTypeName returns the name of the block type used in JSON.
+func blockTypeName(block Block) string {
+	switch block.(type) {
+	case *httpRequestBlock:
+		return "http-request"
+	case *httpResponseBlock:
+		return "http-response"
+	case *revisitBlock:
+		return "revisit"
+	case *warcFieldsBlock:
+		return "warc-fields"
+	case *dnsBlock:
+		return "dns"
+	case *ftpControlBlock:
+		return "ftp-control"
+	default:
+		return "generic"
+	}
+}
+
+// isTextContent returns true if content of the content type is text which can be inlined in JSON.
+func isTextContent(contentType string) bool {
+	mt := mediaType(contentType)
+	return strings.HasPrefix(mt, "text/") || mt == ApplicationWarcFields
+}
+
+func readBlockContent(block Block) ([]byte, error) {
+	if err := block.Cache(); err != nil {
+		return nil, err
+	}
+	r, err := block.RawBytes()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// MarshalJSON implements json.Marshaler. The validation is an array with the message of each error, e.g. for
+// returning it together with the output of [RecordToJSON] when debugging a record.
+func (v Validation) MarshalJSON() ([]byte, error) {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Error()
+	}
+	return json.Marshal(messages)
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordToJSON(t *testing.T) {
+	newResource := func() WarcRecord {
+		rb := NewRecordBuilder(Resource, WithAddMissingDigest(true))
+		rb.AddWarcHeader(WarcRecordID, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+		rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+		rb.AddWarcHeader(WarcTargetURI, "http://www.example.com/")
+		rb.AddWarcHeader(WarcConcurrentTo, "<urn:uuid:1>")
+		rb.AddWarcHeader(WarcConcurrentTo, "<urn:uuid:2>")
+		rb.AddWarcHeader(ContentType, "text/plain")
+		_, err := rb.WriteString("content")
+		require.NoError(t, err)
+		record, _, err := rb.Build()
+		require.NoError(t, err)
+		return record
+	}
+
+	header := `"header":{"WARC-Record-ID":"<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>",` +
+		`"WARC-Date":"2006-01-02T15:04:05Z","WARC-Target-URI":"http://www.example.com/",` +
+		`"WARC-Concurrent-To":["<urn:uuid:1>","<urn:uuid:2>"],"Content-Type":"text/plain",` +
+		`"WARC-Type":"resource","Content-Length":"7","WARC-Block-Digest":"sha1:AQHQN7LXICJEPDKFA52PLORQYXNHRLGI",` +
+		`"WARC-Payload-Digest":"sha1:AQHQN7LXICJEPDKFA52PLORQYXNHRLGI"}`
+
+	record := newResource()
+	got, err := RecordToJSON(record, 0)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":"WARC/1.1",`+header+`,"block":{"type":"generic","length":7,"digest":"sha1:AQHQN7LXICJEPDKFA52PLORQYXNHRLGI"}}`, string(got))
+
+	// json.Marshal uses the MarshalJSON method
+	b, err := json.Marshal(record)
+	require.NoError(t, err)
+	assert.Equal(t, string(got), string(b))
+
+	record = newResource()
+	got, err = RecordToJSON(record, 100)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":"WARC/1.1",`+header+`,"block":{"type":"generic","length":7,"digest":"sha1:AQHQN7LXICJEPDKFA52PLORQYXNHRLGI","content":"content"}}`, string(got))
+
+	// The block is still readable
+	r, err := record.Block().RawBytes()
+	require.NoError(t, err)
+	assert.NotNil(t, r)
+
+	got, err = RecordToJSON(createTestRecord(), 1000)
+	require.NoError(t, err)
+	var v map[string]interface{}
+	require.NoError(t, json.Unmarshal(got, &v))
+	assert.Equal(t, map[string]interface{}{"type": "http-response", "length": float64(258), "digest": "sha1:7CBE117BFA2B22C3A02DEFF3BC04D5F912964A45"}, v["block"])
+}
+
+func TestValidation_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(&Validation{})
+	require.NoError(t, err)
+	assert.Equal(t, `[]`, string(b))
+
+	validation := &Validation{}
+	validation.addError(newHeaderFieldError(WarcDate, "illegal value"))
+	validation.addError(errors.New("missing end of record"))
+	b, err = json.Marshal(validation)
+	require.NoError(t, err)
+	assert.Equal(t, `["gowarc: illegal value at header WARC-Date","missing end of record"]`, string(b))
+}
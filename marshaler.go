@@ -19,23 +19,116 @@ package gowarc
 import (
 	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
-// Marshaler is the interface that wraps the Marshal function.
+// Marshaler is the interface that wraps the Marshal and EstimateSize functions.
 //
 // Marshal converts a WARC record to its serialized form and returns the size of the marshalled record or any error encountered.
 //
 // Depending on implementation, Marshal might return a WarcRecord which is the continuation of the record being written.
 // See the description of record segmentation at https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/#record-segmentation
+//
+// EstimateSize returns the number of uncompressed bytes Marshal would write for the record without writing anything.
 type Marshaler interface {
 	Marshal(w io.Writer, record WarcRecord, maxSize int64) (WarcRecord, int64, error)
+	EstimateSize(record WarcRecord) (int64, error)
 }
 
 type defaultMarshaler struct {
+	endOfRecordMarker string
+	rewriteDate       bool
+	dateDigits        int // Number of fractional second digits in WARC-Date when rewriteDate is set
+}
+
+// NewMarshaler creates a new Marshaler with the supplied options.
+func NewMarshaler(opts ...MarshalerOption) Marshaler {
+	m := &defaultMarshaler{}
+	for _, opt := range opts {
+		opt.apply(m)
+	}
+	return m
+}
+
+// MarshalerOption configures the Marshaler created by [NewMarshaler].
+type MarshalerOption interface {
+	apply(*defaultMarshaler)
+}
+
+// funcMarshalerOption wraps a function that modifies defaultMarshaler into an
+// implementation of the MarshalerOption interface.
+type funcMarshalerOption struct {
+	f func(*defaultMarshaler)
+}
+
+func (fo *funcMarshalerOption) apply(m *defaultMarshaler) {
+	fo.f(m)
 }
 
-func NewMarshaler() Marshaler {
-	return &defaultMarshaler{}
+func newFuncMarshalerOption(f func(*defaultMarshaler)) *funcMarshalerOption {
+	return &funcMarshalerOption{
+		f: f,
+	}
+}
+
+// WithEndOfRecordMarker sets the separator written after the content block of each record.
+//
+// The WARC specification requires exactly two CRLFs, which is what the reader in this package expects. Other values
+// are only meant for interoperability with consumers that expect something else. The marker should consist of line
+// endings only, e.g. "\r\n\r\n\r\n", since the reader in this package accepts extra blank lines between records.
+//
+// defaults to "\r\n\r\n"
+func WithEndOfRecordMarker(marker string) MarshalerOption {
+	return newFuncMarshalerOption(func(m *defaultMarshaler) {
+		m.endOfRecordMarker = marker
+	})
+}
+
+// marker returns the end of record marker, defaulting to the one required by the WARC specification.
+func (m *defaultMarshaler) marker() string {
+	if m.endOfRecordMarker == "" {
+		return crlfcrlf
+	}
+	return m.endOfRecordMarker
+}
+
+// WithDatePrecision makes the Marshaler rewrite WARC-Date to the given precision, e.g. time.Second for the precision
+// used by WARC 1.0 or time.Microsecond. The date is truncated, not rounded. The precision is rounded down to a power
+// of ten between time.Nanosecond and time.Second.
+//
+// WARC 1.0 only allows second precision, so records with a finer precision are written as WARC 1.1. Since WARC-Date is
+// not part of any digested content, digests are not affected. The record itself is not modified.
+func WithDatePrecision(precision time.Duration) MarshalerOption {
+	return newFuncMarshalerOption(func(m *defaultMarshaler) {
+		m.rewriteDate = true
+		m.dateDigits = 0
+		for p := time.Second; p > precision && p > time.Nanosecond; p /= 10 {
+			m.dateDigits++
+		}
+	})
+}
+
+// header returns the version and WARC header to write for the record.
+func (m *defaultMarshaler) header(record WarcRecord) (*WarcVersion, *WarcFields) {
+	version, header := record.Version(), record.WarcHeader()
+	if !m.rewriteDate {
+		return version, header
+	}
+	date, err := header.GetTime(WarcDate)
+	if err != nil {
+		return version, header
+	}
+	layout := "2006-01-02T15:04:05Z07:00"
+	if m.dateDigits > 0 {
+		layout = "2006-01-02T15:04:05." + strings.Repeat("0", m.dateDigits) + "Z07:00"
+		if version == V1_0 {
+			version = V1_1
+		}
+	}
+	header = header.clone()
+	header.Set(WarcDate, date.UTC().Format(layout))
+	return version, header
 }
 
 func (m *defaultMarshaler) Marshal(w io.Writer, record WarcRecord, maxSize int64) (WarcRecord, int64, error) {
@@ -44,16 +137,42 @@ func (m *defaultMarshaler) Marshal(w io.Writer, record WarcRecord, maxSize int64
 	return nil, size, err
 }
 
+// EstimateSize implements the EstimateSize method in the Marshaler interface.
+//
+// The size of a cached block is exact. For a block which is not cached, the Content-Length field is used since
+// computing the size would consume the block.
+func (m *defaultMarshaler) EstimateSize(record WarcRecord) (int64, error) {
+	var blockSize int64
+	if record.Block() != nil && record.Block().IsCached() {
+		blockSize = record.Block().Size()
+	} else {
+		var err error
+		if blockSize, err = record.ContentLength(); err != nil {
+			return 0, fmt.Errorf("could not estimate size of record: %w", err)
+		}
+	}
+
+	version, header := m.header(record)
+	headerSize, err := header.Write(io.Discard)
+	if err != nil {
+		return 0, err
+	}
+	size := int64(len(version.String())+len(crlf)) + headerSize + int64(len(crlf)) + blockSize + int64(len(m.marker()))
+	return size, nil
+}
+
 func (m *defaultMarshaler) writeRecord(w io.Writer, record WarcRecord) (int64, error) {
+	version, header := m.header(record)
+
 	// Write WARC record version
-	n, err := fmt.Fprintf(w, "%v\r\n", record.Version())
+	n, err := fmt.Fprintf(w, "%v\r\n", version)
 	bytesWritten := int64(n)
 	if err != nil {
 		return bytesWritten, err
 	}
 
 	// Write WARC header
-	bw, err := record.WarcHeader().Write(w)
+	bw, err := header.Write(w)
 	bytesWritten += bw
 	if err != nil {
 		return bytesWritten, err
@@ -78,7 +197,7 @@ func (m *defaultMarshaler) writeRecord(w io.Writer, record WarcRecord) (int64, e
 	}
 
 	// Write end of record separator
-	n, err = w.Write([]byte(crlfcrlf))
+	n, err = w.Write([]byte(m.marker()))
 	bytesWritten += int64(n)
 	if err != nil {
 		return bytesWritten, err
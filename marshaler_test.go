@@ -0,0 +1,142 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_defaultMarshaler_EstimateSize(t *testing.T) {
+	sampleRecord := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 19\r\n" +
+		"\r\n" +
+		"This is the content" +
+		"\r\n\r\n"
+
+	emptyBuilder := NewRecordBuilder(Resource)
+	emptyBuilder.AddWarcHeader(WarcDate, "2017-03-06T04:03:53Z")
+	emptyRecord, _, err := emptyBuilder.Build()
+	require.NoError(t, err)
+
+	parsed, _, _, err := NewUnmarshaler(WithSkipParseBlock()).Unmarshal(bufio.NewReader(strings.NewReader(sampleRecord)))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		record WarcRecord
+	}{
+		{"builder record", createTestRecord()},
+		{"empty record", emptyRecord},
+		{"parsed record", parsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMarshaler()
+			estimated, err := m.EstimateSize(tt.record)
+			assert.NoError(t, err)
+
+			buf := &bytes.Buffer{}
+			_, written, err := m.Marshal(buf, tt.record, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, written, estimated)
+			assert.Equal(t, int64(buf.Len()), estimated)
+		})
+	}
+}
+
+func Test_defaultMarshaler_WithEndOfRecordMarker(t *testing.T) {
+	m := NewMarshaler(WithEndOfRecordMarker("\r\n\r\n\r\n"))
+
+	buf := &bytes.Buffer{}
+	for i := 0; i < 2; i++ {
+		record := createTestRecord()
+		estimated, err := m.EstimateSize(record)
+		require.NoError(t, err)
+		_, size, err := m.Marshal(buf, record, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(uncompressedRecordSize+2), size)
+		assert.Equal(t, size, estimated)
+	}
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n\r\n"))
+
+	// The reader accepts the extra blank line between records without warning
+	r, err := NewWarcFileReaderFromStream(bytes.NewReader(buf.Bytes()), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+	for _, wantOffset := range []int64{0, uncompressedRecordSize + 2} {
+		record, offset, validation, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, wantOffset, offset)
+		assert.True(t, validation.Valid(), validation.String())
+		assert.NoError(t, record.Close())
+	}
+}
+
+func Test_defaultMarshaler_WithDatePrecision(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     *WarcVersion
+		date        string
+		precision   time.Duration
+		wantVersion string
+		wantDate    string
+	}{
+		{"truncate to seconds", V1_1, "2006-01-02T15:04:05.123456Z", time.Second, "WARC/1.1", "2006-01-02T15:04:05Z"},
+		{"extend to microseconds", V1_1, "2006-01-02T15:04:05Z", time.Microsecond, "WARC/1.1", "2006-01-02T15:04:05.000000Z"},
+		{"truncate to milliseconds", V1_1, "2006-01-02T15:04:05.123456789Z", time.Millisecond, "WARC/1.1", "2006-01-02T15:04:05.123Z"},
+		{"upgrade version", V1_0, "2006-01-02T15:04:05Z", time.Microsecond, "WARC/1.1", "2006-01-02T15:04:05.000000Z"},
+		{"keep version", V1_0, "2006-01-02T15:04:05Z", time.Second, "WARC/1.0", "2006-01-02T15:04:05Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := NewRecordBuilder(Resource, WithVersion(tt.version), WithSpecViolationPolicy(ErrIgnore), WithSyntaxErrorPolicy(ErrIgnore))
+			rb.AddWarcHeader(WarcRecordID, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+			rb.AddWarcHeader(WarcDate, tt.date)
+			rb.AddWarcHeader(ContentType, "text/plain")
+			_, err := rb.WriteString("content")
+			require.NoError(t, err)
+			record, _, err := rb.Build()
+			require.NoError(t, err)
+
+			m := NewMarshaler(WithDatePrecision(tt.precision))
+			estimated, err := m.EstimateSize(record)
+			require.NoError(t, err)
+			buf := &bytes.Buffer{}
+			_, size, err := m.Marshal(buf, record, 0)
+			require.NoError(t, err)
+			assert.Equal(t, estimated, size)
+			assert.Equal(t, int64(buf.Len()), size)
+
+			assert.True(t, strings.HasPrefix(buf.String(), tt.wantVersion+"\r\n"), buf.String())
+			assert.Contains(t, buf.String(), "WARC-Date: "+tt.wantDate+"\r\n")
+			// The record is not modified
+			assert.Equal(t, tt.date, record.WarcHeader().Get(WarcDate))
+			assert.Equal(t, tt.version, record.Version())
+		})
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// idxFileName returns the name of the offset index file accompanying a WARC file, e.g. foo.idx for foo.warc.gz.
+func idxFileName(warcFileName, compressSuffix string) string {
+	return sidecarFileName(warcFileName, compressSuffix, ".idx")
+}
+
+// idxLine formats a line of an offset index for a record with the given id written at offset with length bytes.
+//
+// The line consists of the record id without the surrounding '<' and '>', the offset and the length separated by a
+// TAB. If the record has WARC-Concurrent-To fields, the concurrent ids, without '<' and '>' and separated by a space,
+// are added as a fourth field. It is terminated by a newline.
+func idxLine(id string, offset, length int64, concurrentTo []string) []byte {
+	line := make([]byte, 0, len(id)+32)
+	line = append(line, id...)
+	line = append(line, '\t')
+	line = strconv.AppendInt(line, offset, 10)
+	line = append(line, '\t')
+	line = strconv.AppendInt(line, length, 10)
+	for i, c := range concurrentTo {
+		if i == 0 {
+			line = append(line, '\t')
+		} else {
+			line = append(line, ' ')
+		}
+		line = append(line, strings.Trim(c, "<>")...)
+	}
+	return append(line, '\n')
+}
+
+// RecordLocation is the position of a record in a WARC file.
+type RecordLocation struct {
+	FileName string // Path of the WARC file
+	Offset   int64  // Offset of the record in the WARC file
+	Length   int64  // Length of the record, including compression, in the WARC file
+}
+
+// ErrRecordNotFound is returned by [OffsetIndexResolver.Resolve] when a record is not found in any offset index.
+var ErrRecordNotFound = errors.New("gowarc: record not found")
+
+// OffsetIndexResolver resolves record ids to the location of the records using the offset index files written next
+// to WARC files by [WithOffsetIndexSidecar].
+//
+// The index files are loaded lazily. When an id is not found in the index files loaded so far, the directory is
+// listed and new index files are loaded until the id is found. An index file is only used when the WARC file it
+// indexes is finalized, i.e. has the extension .warc or .warc.gz. Use [NewOffsetIndexResolver] to create a new
+// instance. It is safe for concurrent use.
+type OffsetIndexResolver struct {
+	dir        string
+	mu         sync.Mutex
+	loaded     map[string]bool // Names of the index files loaded
+	locations  map[string]RecordLocation
+	concurrent map[string][]string // Ids of concurrent records in both directions
+}
+
+// NewOffsetIndexResolver creates a new OffsetIndexResolver for the WARC files in dir.
+func NewOffsetIndexResolver(dir string) *OffsetIndexResolver {
+	return &OffsetIndexResolver{
+		dir:        dir,
+		loaded:     make(map[string]bool),
+		locations:  make(map[string]RecordLocation),
+		concurrent: make(map[string][]string),
+	}
+}
+
+// Resolve returns the location of the record with the given WARC-Record-ID. The surrounding '<' and '>' of the id
+// are optional.
+//
+// [ErrRecordNotFound] is returned if the id is not found in any of the index files.
+func (r *OffsetIndexResolver) Resolve(id string) (RecordLocation, error) {
+	id = strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if loc, ok := r.locations[id]; ok {
+		return loc, nil
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return RecordLocation{}, err
+	}
+	warcFiles := make(map[string]string)
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && (strings.HasSuffix(name, ".warc") || strings.HasSuffix(name, ".warc.gz")) {
+			warcFiles[idxFileName(name, ".gz")] = name
+		}
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || path.Ext(name) != ".idx" || r.loaded[name] {
+			continue
+		}
+		warcFile, ok := warcFiles[name]
+		if !ok {
+			// The WARC file is still being written
+			continue
+		}
+		if err := r.load(name, warcFile); err != nil {
+			return RecordLocation{}, err
+		}
+		r.loaded[name] = true
+		if loc, ok := r.locations[id]; ok {
+			return loc, nil
+		}
+	}
+	return RecordLocation{}, ErrRecordNotFound
+}
+
+// ResolveConcurrent returns the ids of the records concurrent to the record with the given WARC-Record-ID, e.g. the
+// request record of a response. The ids are returned without the surrounding '<' and '>' and can be resolved with
+// Resolve.
+//
+// Both the ids in the WARC-Concurrent-To fields of the record and the ids of records referencing it in their
+// WARC-Concurrent-To fields are returned. A referencing record is only found if it is in a loaded index file. Since
+// concurrent records are written together, it is normally in the same file as the record itself.
+//
+// [ErrRecordNotFound] is returned if the id is not found in any of the index files.
+func (r *OffsetIndexResolver) ResolveConcurrent(id string) ([]string, error) {
+	if _, err := r.Resolve(id); err != nil {
+		return nil, err
+	}
+	id = strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.concurrent[id]), nil
+}
+
+// RemoveFile forgets the records in the WARC file with the given path, e.g. when the file is deleted.
+//
+// The path is matched against [RecordLocation.FileName]. The index file is loaded again if it is found when resolving
+// an id, so the index file should be deleted together with the WARC file.
+func (r *OffsetIndexResolver) RemoveFile(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeFile(filepath.Clean(path))
+}
+
+// Prune forgets the records in WARC files which no longer exist.
+func (r *OffsetIndexResolver) Prune() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files := make(map[string]bool)
+	for _, loc := range r.locations {
+		files[loc.FileName] = true
+	}
+	for path := range files {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			r.removeFile(path)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFile removes the locations in the WARC file with the given path and marks its index file as not loaded.
+func (r *OffsetIndexResolver) removeFile(path string) {
+	for id, loc := range r.locations {
+		if loc.FileName == path {
+			delete(r.locations, id)
+			delete(r.concurrent, id)
+		}
+	}
+	delete(r.loaded, idxFileName(filepath.Base(path), ".gz"))
+}
+
+// addConcurrent records that the record with id other is concurrent to the record with id.
+func (r *OffsetIndexResolver) addConcurrent(id, other string) {
+	if !slices.Contains(r.concurrent[id], other) {
+		r.concurrent[id] = append(r.concurrent[id], other)
+	}
+}
+
+// load adds the records in the index file idxFile to the known locations.
+func (r *OffsetIndexResolver) load(idxFile, warcFile string) error {
+	f, err := os.Open(filepath.Join(r.dir, idxFile))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	warcPath := filepath.Join(r.dir, warcFile)
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 && len(fields) != 4 {
+			return fmt.Errorf("gowarc: %s: line %d: expected 3 or 4 fields, was %d", idxFile, lineNumber, len(fields))
+		}
+		offset, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("gowarc: %s: line %d: illegal offset: %w", idxFile, lineNumber, err)
+		}
+		length, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("gowarc: %s: line %d: illegal length: %w", idxFile, lineNumber, err)
+		}
+		r.locations[fields[0]] = RecordLocation{FileName: warcPath, Offset: offset, Length: length}
+		if len(fields) == 4 {
+			for _, c := range strings.Fields(fields[3]) {
+				r.addConcurrent(fields[0], c)
+				r.addConcurrent(c, fields[0])
+			}
+		}
+	}
+	return scanner.Err()
+}
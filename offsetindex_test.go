@@ -0,0 +1,257 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarcFileWriter_WithOffsetIndexSidecar(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithFileNameGenerator(&PatternNameGenerator{Directory: "mem", Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(0),
+		WithOffsetIndexSidecar(true),
+		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+			rb.AddWarcHeader(WarcRecordID, "<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>")
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}))
+
+	res1 := w.Write(createTestRecord())
+	require.NoError(t, res1[0].Err)
+	record := createTestRecord()
+	record.WarcHeader().Set(WarcRecordID, "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>")
+	res2 := w.Write(record)
+	require.NoError(t, res2[0].Err)
+	assert.Equal(t, []string{"mem/test-0001.idx.open", "mem/test-0001.warc.gz.open"}, m.Names())
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"mem/test-0001.idx", "mem/test-0001.warc.gz"}, m.Names())
+
+	warc, err := m.ReadFile("mem/test-0001.warc.gz")
+	require.NoError(t, err)
+	b, err := m.ReadFile("mem/test-0001.idx")
+	require.NoError(t, err)
+	want := fmt.Sprintf("urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008\t0\t%d\n", res1[0].FileOffset) +
+		fmt.Sprintf("urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008\t%d\t%d\n", res1[0].FileOffset, res2[0].FileOffset-res1[0].FileOffset) +
+		fmt.Sprintf("urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008\t%d\t%d\n", res2[0].FileOffset, int64(len(warc))-res2[0].FileOffset)
+	assert.Equal(t, want, string(b))
+}
+
+func TestIdxFileName(t *testing.T) {
+	assert.Equal(t, "foo.idx", idxFileName("foo.warc.gz", ".gz"))
+	assert.Equal(t, "foo-1.0.idx", idxFileName("foo-1.0.warc", ""))
+}
+
+func TestOffsetIndexResolver(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWarcFileWriter(
+		WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(compressedRecordSize+1),
+		WithOffsetIndexSidecar(true))
+
+	ids := []string{
+		"<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>",
+		"<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>",
+		"<urn:uuid:cccccccc-0221-11e7-adb1-0242ac120008>",
+	}
+	var results []WriteResponse
+	for _, id := range ids {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcRecordID, id)
+		res := w.Write(record)
+		require.NoError(t, res[0].Err)
+		results = append(results, res[0])
+	}
+
+	resolver := NewOffsetIndexResolver(dir)
+
+	// The last file is still open
+	_, err := resolver.Resolve(ids[2])
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	require.NoError(t, w.Close())
+
+	for i, id := range ids {
+		loc, err := resolver.Resolve(id)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, results[i].FileName), loc.FileName)
+		assert.Equal(t, results[i].FileOffset, loc.Offset)
+		// Each record is written to its own file
+		fi, err := os.Stat(loc.FileName)
+		require.NoError(t, err)
+		assert.Equal(t, fi.Size(), loc.Length)
+
+		r, err := NewWarcFileReader(loc.FileName, loc.Offset)
+		require.NoError(t, err)
+		record, _, _, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, id, record.WarcHeader().Get(WarcRecordID))
+		assert.NoError(t, record.Close())
+		assert.NoError(t, r.Close())
+	}
+
+	loc, err := resolver.Resolve("urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008")
+	require.NoError(t, err)
+	assert.Equal(t, results[0].FileOffset, loc.Offset)
+
+	_, err = resolver.Resolve("<urn:uuid:dddddddd-0221-11e7-adb1-0242ac120008>")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestOffsetIndexResolver_Prune(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWarcFileWriter(
+		WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(compressedRecordSize+1),
+		WithOffsetIndexSidecar(true))
+	ids := []string{"<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>", "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>"}
+	for _, id := range ids {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcRecordID, id)
+		require.NoError(t, w.Write(record)[0].Err)
+	}
+	require.NoError(t, w.Close())
+
+	resolver := NewOffsetIndexResolver(dir)
+	for _, id := range ids {
+		_, err := resolver.Resolve(id)
+		require.NoError(t, err)
+	}
+
+	// Delete the first file and its index
+	loc, err := resolver.Resolve(ids[0])
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(loc.FileName))
+	require.NoError(t, os.Remove(filepath.Join(dir, "test-0001.idx")))
+
+	require.NoError(t, resolver.Prune())
+	_, err = resolver.Resolve(ids[0])
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	_, err = resolver.Resolve(ids[1])
+	assert.NoError(t, err)
+
+	loc, err = resolver.Resolve(ids[1])
+	require.NoError(t, err)
+	resolver.RemoveFile(loc.FileName)
+	assert.Empty(t, resolver.locations)
+
+	// The index file is still present, so it is loaded again
+	_, err = resolver.Resolve(ids[1])
+	assert.NoError(t, err)
+}
+
+func TestOffsetIndexResolver_ResolveConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWarcFileWriter(
+		WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(0),
+		WithOffsetIndexSidecar(true))
+
+	// Only the request references the response, like most crawlers do
+	response := createTestRecord()
+	response.WarcHeader().Set(WarcRecordID, "<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>")
+	request := createTestRecord()
+	request.WarcHeader().Set(WarcRecordID, "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>")
+	request.WarcHeader().AddId(WarcConcurrentTo, "<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>")
+	other := createTestRecord()
+	other.WarcHeader().Set(WarcRecordID, "<urn:uuid:cccccccc-0221-11e7-adb1-0242ac120008>")
+	for _, record := range []WarcRecord{response, request, other} {
+		res := w.Write(record)
+		require.NoError(t, res[0].Err)
+	}
+	require.NoError(t, w.Close())
+
+	b, err := os.ReadFile(filepath.Join(dir, "test-0001.idx"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "\turn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008\n")
+
+	resolver := NewOffsetIndexResolver(dir)
+	ids, err := resolver.ResolveConcurrent("<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008"}, ids)
+
+	ids, err = resolver.ResolveConcurrent("urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008"}, ids)
+
+	ids, err = resolver.ResolveConcurrent("urn:uuid:cccccccc-0221-11e7-adb1-0242ac120008")
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	_, err = resolver.ResolveConcurrent("urn:uuid:dddddddd-0221-11e7-adb1-0242ac120008")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+// failingIdxFileSystem is a MemFileSystem where the first write to an offset index file fails.
+type failingIdxFileSystem struct {
+	*MemFileSystem
+	failed bool
+}
+
+func (f *failingIdxFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.MemFileSystem.OpenFile(name, flag, perm)
+	if err != nil || !strings.Contains(name, ".idx") {
+		return file, err
+	}
+	return &failingIdxFile{File: file, fs: f}, nil
+}
+
+type failingIdxFile struct {
+	File
+	fs *failingIdxFileSystem
+}
+
+func (f *failingIdxFile) Write(p []byte) (int, error) {
+	if !f.fs.failed {
+		f.fs.failed = true
+		return 0, errors.New("write failed")
+	}
+	return f.File.Write(p)
+}
+
+func TestWarcFileWriter_WithOffsetIndexSidecar_writeError(t *testing.T) {
+	m := &failingIdxFileSystem{MemFileSystem: NewMemFileSystem()}
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Directory: "mem", Pattern: "test-%04{serial}d.warc"}),
+		WithMaxFileSize(0),
+		WithOffsetIndexSidecar(true))
+
+	res1 := w.Write(createTestRecord())
+	assert.Error(t, res1[0].Err)
+	record := createTestRecord()
+	record.WarcHeader().Set(WarcRecordID, "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>")
+	res2 := w.Write(record)
+	require.NoError(t, res2[0].Err)
+	require.NoError(t, w.Close())
+
+	// The failed index line doesn't affect the offset and length of the next record
+	assert.Equal(t, uncompressedRecordSize, res2[0].FileOffset)
+	b, err := m.ReadFile("mem/test-0001.idx")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008\t%d\t%d\n", uncompressedRecordSize, uncompressedRecordSize), string(b))
+}
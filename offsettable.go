@@ -0,0 +1,174 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/nlnwa/gowarc/v2/internal/timestamp"
+)
+
+// ApplicationOffsetTable is the Content-Type of the metadata record holding the offset table written by
+// [WithOffsetTable].
+const ApplicationOffsetTable = "application/vnd.gowarc.offset-table+json"
+
+// OffsetTableEntry is the location of a record in an offset table.
+type OffsetTableEntry struct {
+	Id     string `json:"id"`     // WARC-Record-ID without the surrounding '<' and '>'
+	Offset int64  `json:"offset"` // Offset of the record in the WARC file
+	Length int64  `json:"length"` // Length of the record, including compression, in the WARC file
+}
+
+// offsetTable is the content block of an offset table record.
+type offsetTable struct {
+	Records []OffsetTableEntry `json:"records"`
+}
+
+// ErrNoOffsetTable is returned by [ReadOffsetTable] when the last record of a WARC file is not an offset table.
+var ErrNoOffsetTable = errors.New("gowarc: no offset table at end of file")
+
+// newOffsetTableRecord creates the metadata record holding the offset table for entries.
+func (w *singleWarcFileWriter) newOffsetTableRecord(entries []OffsetTableEntry) (WarcRecord, error) {
+	content, err := json.Marshal(offsetTable{Records: entries})
+	if err != nil {
+		return nil, err
+	}
+	rb := NewRecordBuilder(Metadata, w.opts.recordOptions...)
+	rb.AddWarcHeader(WarcDate, timestamp.UTCW3cIso8601(w.opts.clock()))
+	rb.AddWarcHeader(ContentType, ApplicationOffsetTable)
+	if _, err := rb.Write(content); err != nil {
+		_ = rb.Close()
+		return nil, err
+	}
+	record, _, err := rb.Build()
+	return record, err
+}
+
+// writeOffsetTable writes the offset table as the last record of the current file.
+func (w *singleWarcFileWriter) writeOffsetTable() error {
+	record, err := w.newOffsetTableRecord(w.offsetTable)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = record.Close() }()
+
+	offset := w.currentFileSize
+	n, err := w.writeRecord(w.currentFile, record, 0)
+	if err != nil {
+		return err
+	}
+	fi, err := w.currentFile.Stat()
+	if err != nil {
+		return err
+	}
+	w.currentFileSize = fi.Size()
+	w.uncompressedSize += n
+	return w.writeIdx(record, offset, fi.Size()-offset)
+}
+
+// ReadOffsetTable reads the offset table written as the last record of a WARC file by [WithOffsetTable].
+//
+// The file is searched backwards from the end for the start of the last record, so the table is found without
+// reading the rest of the file. [ErrNoOffsetTable] is returned if the last record is not an offset table.
+func ReadOffsetTable(r io.ReaderAt, size int64, opts ...WarcRecordOption) ([]OffsetTableEntry, error) {
+	u := NewUnmarshaler(opts...)
+	pos := size
+	for pos > 0 {
+		candidate, err := prevRecordCandidate(r, pos)
+		if err != nil {
+			return nil, err
+		}
+		if candidate < 0 {
+			break
+		}
+		pos = candidate
+
+		record, _, _, err := u.Unmarshal(bufio.NewReader(io.NewSectionReader(r, candidate, size-candidate)))
+		if err != nil {
+			// Not the start of a record, e.g. magic bytes in compressed data
+			if record != nil {
+				_ = record.Close()
+			}
+			continue
+		}
+		entries, err := readOffsetTableRecord(record)
+		_ = record.Close()
+		return entries, err
+	}
+	return nil, ErrNoOffsetTable
+}
+
+// readOffsetTableRecord returns the entries of an offset table record.
+func readOffsetTableRecord(record WarcRecord) ([]OffsetTableEntry, error) {
+	if record.Type() != Metadata || record.WarcHeader().Get(ContentType) != ApplicationOffsetTable {
+		return nil, ErrNoOffsetTable
+	}
+	content, err := record.Block().RawBytes()
+	if err != nil {
+		return nil, err
+	}
+	var table offsetTable
+	if err := json.NewDecoder(content).Decode(&table); err != nil {
+		return nil, err
+	}
+	return table.Records, nil
+}
+
+// prevRecordCandidate returns the offset of the last possible start of a record before pos.
+// If no candidate is found, -1 is returned.
+func prevRecordCandidate(r io.ReaderAt, pos int64) (int64, error) {
+	// Overlap chunks to find magic bytes spanning a chunk boundary
+	overlap := int64(len(warcMagic) - 1)
+	chunk := make([]byte, scanChunkSize+overlap)
+	for pos > 0 {
+		start := pos - scanChunkSize
+		if start < 0 {
+			start = 0
+		}
+		n, err := r.ReadAt(chunk[:pos-start+overlap], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return -1, err
+		}
+		b := chunk[:n]
+		// Only magic bytes starting before pos are candidates
+		end := int(pos - start)
+		i := lastIndexBefore(b, warcMagic, end)
+		if j := lastIndexBefore(b, gzipMagic, end); j > i {
+			i = j
+		}
+		if i >= 0 {
+			return start + int64(i), nil
+		}
+		pos = start
+	}
+	return -1, nil
+}
+
+// lastIndexBefore returns the index of the last instance of sep in b starting before end, or -1 if there is none.
+func lastIndexBefore(b, sep []byte, end int) int {
+	for {
+		i := bytes.LastIndex(b, sep)
+		if i < end {
+			return i
+		}
+		b = b[:i+len(sep)-1]
+	}
+}
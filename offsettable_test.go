@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarcFileWriter_WithOffsetTable(t *testing.T) {
+	for _, compress := range []bool{true, false} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			m := NewMemFileSystem()
+			w := NewWarcFileWriter(
+				WithFileSystem(m),
+				WithCompression(compress),
+				WithMaxFileSize(0),
+				WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+				WithOffsetTable(true),
+				WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+					_, err := rb.WriteString("software: test\r\n")
+					return err
+				}))
+
+			ids := []string{
+				"<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>",
+				"<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>",
+				"<urn:uuid:cccccccc-0221-11e7-adb1-0242ac120008>",
+			}
+			var results []WriteResponse
+			for _, id := range ids {
+				record := createTestRecord()
+				record.WarcHeader().Set(WarcRecordID, id)
+				res := w.Write(record)
+				require.NoError(t, res[0].Err)
+				results = append(results, res[0])
+			}
+			require.NoError(t, w.Close())
+
+			b, err := m.ReadFile(results[0].FileName)
+			require.NoError(t, err)
+			entries, err := ReadOffsetTable(bytes.NewReader(b), int64(len(b)))
+			require.NoError(t, err)
+
+			// The warcinfo record comes first
+			require.Len(t, entries, 4)
+			assert.Equal(t, int64(0), entries[0].Offset)
+			assert.Equal(t, results[0].FileOffset, entries[0].Length)
+			for i, res := range results {
+				e := entries[i+1]
+				assert.Equal(t, ids[i], "<"+e.Id+">")
+				assert.Equal(t, res.FileOffset, e.Offset)
+
+				r, err := NewWarcFileReaderFromStream(bytes.NewReader(b), e.Offset)
+				require.NoError(t, err)
+				record, offset, _, err := r.Next()
+				require.NoError(t, err)
+				assert.Equal(t, e.Offset, offset)
+				assert.Equal(t, ids[i], record.WarcHeader().Get(WarcRecordID))
+				assert.NoError(t, record.Close())
+				assert.NoError(t, r.Close())
+			}
+		})
+	}
+}
+
+func TestReadOffsetTable_missing(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}))
+	res := w.Write(createTestRecord(), createTestRecord())
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+
+	b, err := m.ReadFile(res[0].FileName)
+	require.NoError(t, err)
+	_, err = ReadOffsetTable(bytes.NewReader(b), int64(len(b)))
+	assert.ErrorIs(t, err, ErrNoOffsetTable)
+
+	_, err = ReadOffsetTable(bytes.NewReader(nil), 0)
+	assert.ErrorIs(t, err, ErrNoOffsetTable)
+}
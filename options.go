@@ -17,28 +17,50 @@
 package gowarc
 
 import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/nlnwa/gowarc/v2/internal/diskbuffer"
 )
 
 type warcRecordOptions struct {
-	warcVersion              *WarcVersion
-	errSyntax                errorPolicy
-	errSpec                  errorPolicy
-	errUnknownRecordType     errorPolicy
-	errBlock                 errorPolicy
-	skipParseBlock           bool
-	addMissingRecordId       bool
-	recordIdFunc             func() (string, error)
-	addMissingContentLength  bool
-	addMissingDigest         bool
-	fixContentLength         bool
-	fixDigest                bool
-	fixSyntaxErrors          bool
-	fixWarcFieldsBlockErrors bool
-	defaultDigestAlgorithm   string
-	defaultDigestEncoding    digestEncoding
-	bufferOptions            []diskbuffer.Option
+	warcVersion               *WarcVersion
+	errSyntax                 errorPolicy
+	errSpec                   errorPolicy
+	errUnknownRecordType      errorPolicy
+	errBlock                  errorPolicy
+	skipParseBlock            bool
+	addMissingRecordId        bool
+	recordIdFunc              func() (string, error)
+	addMissingContentLength   bool
+	addMissingDigest          bool
+	fixContentLength          bool
+	fixDigest                 bool
+	fixSyntaxErrors           bool
+	fixWarcFieldsBlockErrors  bool
+	keepInvalidValues         bool
+	defaultDigestAlgorithm    string
+	defaultDigestEncoding     digestEncoding
+	digestSpecs               []DigestSpec
+	redactionKey              []byte
+	bufferOptions             []diskbuffer.Option
+	progressFunc              func(bytesRead, fileSize, records int64)
+	unknownHeader             unknownHeaderPolicy
+	targetURI                 targetURIPolicy
+	dateFrom                  time.Time
+	dateTo                    time.Time
+	readBufferSize            int
+	readBufferPool            *ReadBufferPool
+	readLimit                 int64
+	maxRecords                int64
+	duplicateFilterSize       int
+	duplicateFilterRate       float64
+	singleStreamDecompression bool
+	failFast                  bool
+	contentLengthTolerance    int
 }
 
 // The errorPolicy constants describe how to handle WARC record errors.
@@ -50,11 +72,45 @@ const (
 	ErrFail   errorPolicy = 2 // Fail on given error.
 )
 
+// The unknownHeaderPolicy constants describe how to handle WARC header fields which are not defined by the WARC
+// specification or any known extension.
+type unknownHeaderPolicy int8
+
+const (
+	UnknownHeaderKeep unknownHeaderPolicy = 0 // Keep the field.
+	UnknownHeaderWarn unknownHeaderPolicy = 1 // Keep the field, but submit a warning.
+	UnknownHeaderDrop unknownHeaderPolicy = 2 // Remove the field from the record.
+)
+
+// The targetURIPolicy constants describe how [WarcRecordBuilder] handles a WARC-Target-URI containing characters which
+// are not allowed in a URI, e.g. spaces.
+type targetURIPolicy int8
+
+const (
+	TargetURIKeep      targetURIPolicy = 0 // Keep the value as is.
+	TargetURIValidate  targetURIPolicy = 1 // Report illegal characters as a violation of the spec.
+	TargetURINormalize targetURIPolicy = 2 // Percent-encode illegal characters.
+)
+
 // defaultIdGenerator is the default function used to generate record ids.
 var defaultIdGenerator = func() (string, error) {
 	return uuid.New().URN(), nil
 }
 
+// NewDeterministicIdFunc returns a function generating record ids which are the same every time a program is run,
+// e.g. for producing byte-identical WARC files in tests. Use it with [WithRecordIdFunc].
+//
+// The ids are name-based uuids computed from seed and a counter which is increased for every id. Different seeds give
+// different sequences of ids. The returned function is safe for concurrent use, but then the order of the ids depends
+// on the order of the calls.
+func NewDeterministicIdFunc(seed string) func() (string, error) {
+	var counter atomic.Uint64
+	return func() (string, error) {
+		name := seed + "/" + strconv.FormatUint(counter.Add(1), 10)
+		return uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)).URN(), nil
+	}
+}
+
 // WarcRecordOption configures validation, marshaling and unmarshaling of WARC records.
 type WarcRecordOption interface {
 	apply(*warcRecordOptions)
@@ -76,8 +132,11 @@ func newFuncWarcRecordOption(f func(*warcRecordOptions)) *funcWarcRecordOption {
 	}
 }
 
+// enableRandPool makes uuid generation faster. EnableRandPool is not safe for concurrent use, so it is only called once.
+var enableRandPool sync.Once
+
 func defaultWarcRecordOptions() warcRecordOptions {
-	uuid.EnableRandPool()
+	enableRandPool.Do(uuid.EnableRandPool)
 	return warcRecordOptions{
 		warcVersion:              V1_1,
 		errSyntax:                ErrWarn,
@@ -134,6 +193,30 @@ func WithSpecViolationPolicy(policy errorPolicy) WarcRecordOption {
 	})
 }
 
+// WithUnknownHeaderPolicy sets the policy for handling unknown WARC header fields, e.g. vendor specific X- fields.
+//
+// The policy only applies to well-formed fields. Malformed header lines are handled by the syntax error policy.
+//
+// defaults to UnknownHeaderKeep
+func WithUnknownHeaderPolicy(policy unknownHeaderPolicy) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.unknownHeader = policy
+	})
+}
+
+// WithTargetURIPolicy sets the policy for checking WARC-Target-URI when a record is built by [WarcRecordBuilder].
+//
+// Violations are handled according to the policy set by [WithSpecViolationPolicy]. Values which can't be parsed as an
+// absolute URI, e.g. relative URIs, are reported by the header validation regardless of this policy and are, like
+// other invalid header values, replaced by an empty string.
+//
+// defaults to TargetURIKeep
+func WithTargetURIPolicy(policy targetURIPolicy) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.targetURI = policy
+	})
+}
+
 // WithUnknownRecordTypePolicy sets the policy for handling unknown record types.
 //
 // defaults to ErrWarn
@@ -168,6 +251,9 @@ func WithAddMissingRecordId(addMissingRecordId bool) WarcRecordOption {
 // Expected output is a valid URI without the surrounding '<' and '>' as described in the WARC spec
 // (https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/#warc-record-id-mandatory)
 //
+// Use [NewDeterministicIdFunc] to get the same ids on every run. For the warcinfo records written by [WarcFileWriter],
+// pass this option to [WithRecordOptions].
+//
 // defaults to generating uuid
 func WithRecordIdFunc(recordIdFunc func() (string, error)) WarcRecordOption {
 	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
@@ -206,6 +292,17 @@ func WithDefaultDigestAlgorithm(defaultDigestAlgorithm string) WarcRecordOption
 	})
 }
 
+// WithRedactionKey sets the secret key used for the HMAC replacing a header value redacted with [RedactHash].
+//
+// The key should be random and kept secret, e.g. 32 bytes from crypto/rand. Use the same key across files to be able
+// to see that records share a value.
+// This option is only used by [RedactHttpHeaders] and [NewHttpHeaderRedactor].
+func WithRedactionKey(key []byte) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.redactionKey = key
+	})
+}
+
 // WithDefaultDigestEncoding sets which encoding to use for digest generation.
 //
 // Valid values: Base16, Base32 and Base64.
@@ -217,6 +314,35 @@ func WithDefaultDigestEncoding(defaultDigestEncoding digestEncoding) WarcRecordO
 	})
 }
 
+// WithDigests sets the algorithm and encoding to use for each digest field, e.g. sha1 for WARC-Block-Digest and sha256
+// for WARC-Payload-Digest.
+//
+// The digests are used when a digest field is missing and WithAddMissingDigest is set. All digests are computed in the
+// same pass over the block. Fields which are not in specs use the default algorithm and encoding. Digest fields
+// present in the record are validated with their own algorithm.
+func WithDigests(specs []DigestSpec) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.digestSpecs = specs
+	})
+}
+
+// digestFor returns the algorithm and encoding to use for a new digest in field.
+func (o *warcRecordOptions) digestFor(field string) (algorithm string, encoding digestEncoding) {
+	algorithm, encoding = o.defaultDigestAlgorithm, o.defaultDigestEncoding
+	for _, spec := range o.digestSpecs {
+		if spec.Field != field {
+			continue
+		}
+		if spec.Algorithm != "" {
+			algorithm = spec.Algorithm
+		}
+		if spec.Encoding != unknown {
+			encoding = spec.Encoding
+		}
+	}
+	return
+}
+
 // WithFixContentLength sets if a ContentLength header with value which do not match the actual content length should be set to the real value.
 //
 // # This will not have any impact if SpecViolationPolicy is ErrIgnore
@@ -305,6 +431,59 @@ func WithStrictValidation() WarcRecordOption {
 	})
 }
 
+// WithConformanceValidation sets the parser to check a record against the WARC specification as thoroughly as possible
+// and collect every problem found in the Validation.
+//
+// This option is meant for certifying WARC files, e.g. before archival. Nothing is fixed or added to the record, so
+// what is validated is the record exactly as it was read. The checks done are:
+//
+//   - WARC version line and header lines are terminated by CRLF
+//   - records start at the expected offset, apart from extra blank lines between records, and end with the end of
+//     record marker
+//   - the record type is known
+//   - the mandatory fields WARC-Record-ID, Content-Length, WARC-Date and WARC-Type are present, as is Content-Type
+//     for records with content
+//   - field values have the correct syntax, e.g. dates, record ids, URIs, IP addresses and numbers
+//   - fields are allowed in the record type and single-valued fields are not repeated
+//   - Content-Length matches the length of the block
+//   - WARC-Block-Digest and WARC-Payload-Digest match the content
+//   - warc-fields and HTTP blocks are well-formed
+//
+// The order of header fields is not significant according to the WARC specification and is not checked. A header
+// value with invalid syntax is kept as read, while it is replaced by an empty string with the other settings.
+//
+// Settings implied by this option are:
+//
+//	SyntaxErrorPolicy = ErrWarn
+//	SpecViolationPolicy = ErrWarn
+//	UnknownRecordPolicy = ErrWarn
+//	BlockErrorPolicy = ErrWarn
+//	SkipParseBlock = false
+//	AddMissingRecordId = false
+//	AddMissingContentLength = false
+//	AddMissingDigest = false
+//	FixContentLength = false
+//	FixDigest = false
+//	FixSyntaxErrors = false
+//	FixWarcFieldsBlockErrors = false
+func WithConformanceValidation() WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.errSyntax = ErrWarn
+		o.errSpec = ErrWarn
+		o.errUnknownRecordType = ErrWarn
+		o.errBlock = ErrWarn
+		o.skipParseBlock = false
+		o.addMissingRecordId = false
+		o.addMissingContentLength = false
+		o.addMissingDigest = false
+		o.fixContentLength = false
+		o.fixDigest = false
+		o.fixSyntaxErrors = false
+		o.fixWarcFieldsBlockErrors = false
+		o.keepInvalidValues = true
+	})
+}
+
 // WithBufferTmpDir sets the directory to use for temporary files.
 //
 // If not set or dir is the empty string then the default directory for temporary files is used (see os.TempDir).
@@ -322,3 +501,154 @@ func WithBufferMaxMemBytes(size int64) WarcRecordOption {
 		o.bufferOptions = append(o.bufferOptions, diskbuffer.WithMaxMemBytes(size))
 	})
 }
+
+// WithProgressFunc sets a function for reporting progress while reading a WARC file.
+//
+// Since the content of a record is read lazily, progress for a record is reported by the following call to
+// [WarcFileReader.Next], i.e. the call which returns io.EOF reports the final progress. The function is called with
+// the number of bytes read from the start of the file, the size of the file and the number of records read so far. If the size of the file is unknown, e.g. when reading from a pipe, fileSize is 0.
+// This option is only used by [WarcFileReader].
+func WithProgressFunc(f func(bytesRead, fileSize, records int64)) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.progressFunc = f
+	})
+}
+
+// WithReadBufferSize sets the size of the buffer used by [WarcFileReader] when reading from the underlying file.
+//
+// By default a 1 MiB buffer is taken from a pool shared by all readers. A buffer with another size is allocated for
+// each reader and is not pooled, use [WithReadBufferPool] to reuse it across files.
+// This option is only used by [WarcFileReader].
+func WithReadBufferSize(size int) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.readBufferSize = size
+	})
+}
+
+// WithReadBufferPool makes [WarcFileReader] take its buffer from pool and return it when the reader is closed. The size
+// of the buffer is set by the pool, and WithReadBufferSize is ignored.
+//
+// This avoids allocating a new buffer for each file when reading many files with a buffer size other than the default.
+// This option is only used by [WarcFileReader].
+func WithReadBufferPool(pool *ReadBufferPool) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.readBufferPool = pool
+	})
+}
+
+// WithReadLimit makes [WarcFileReader.Next] return io.EOF after about n bytes are read, e.g. for sampling the first
+// part of a huge WARC file.
+//
+// The limit is checked at record boundaries, so a record starting before the limit is read to its end. Reading stops
+// at the first record starting n or more bytes after the offset the reader was created with.
+// This option is only used by [WarcFileReader].
+//
+// defaults to 0, i.e. no limit
+func WithReadLimit(n int64) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.readLimit = n
+	})
+}
+
+// WithMaxRecords makes [WarcFileReader.Next] return io.EOF after n records are returned, e.g. for previews.
+//
+// Records skipped by [WithDateRange] are not counted. The offsets of the returned records are the same as without the
+// limit.
+// This option is only used by [WarcFileReader].
+//
+// defaults to 0, i.e. no limit
+func WithMaxRecords(n int) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.maxRecords = int64(n)
+	})
+}
+
+// WithSingleStreamDecompression makes [WarcFileReader] decompress the whole input as one gzip stream before parsing
+// records, as needed for files written with [WithSingleStreamCompression].
+//
+// Random access by offset is unavailable for such files. Offsets returned by [WarcFileReader.Next] are counted in the
+// decompressed stream, and a reader created with an offset decompresses the file from the start to get there. The
+// size of the file is not reported to the function set by [WithProgressFunc].
+// This option is only used by [WarcFileReader].
+//
+// defaults to false
+func WithSingleStreamDecompression() WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.singleStreamDecompression = true
+	})
+}
+
+// defaultDuplicateFilterRate is the false positive rate used by WithDuplicateFilter if the given rate is out of range.
+const defaultDuplicateFilterRate = 0.01
+
+// WithDuplicateFilter makes [FindDuplicates] read the file twice to bound the memory used for huge files.
+//
+// The first pass adds every value to a bloom filter sized for expectedValues values with the given false positive
+// rate, and keeps the values which might have been seen before. The second pass collects the offsets of these
+// candidates only, so the result is still exact. Each record has one or two values, its WARC-Record-ID and
+// WARC-Payload-Digest. A rate of 0.01 uses about 1.2 bytes per expected value. If the file holds more values than
+// expected, the filter gives more false positives, which costs memory, but not correctness.
+// A rate outside the range (0, 1) is replaced by 0.01.
+// This option is only used by [FindDuplicates].
+//
+// defaults to 0, i.e. all values are kept in memory
+func WithDuplicateFilter(expectedValues int, falsePositiveRate float64) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.duplicateFilterSize = expectedValues
+		o.duplicateFilterRate = falsePositiveRate
+	})
+}
+
+// WithDateRange makes [WarcFileReader.Next] skip records with a WARC-Date outside the range from (inclusive) to
+// (exclusive). A zero time leaves that end of the range open.
+//
+// The date is checked as soon as the header is parsed, so the block of a skipped record is discarded without being
+// parsed or validated. Records without a parsable WARC-Date are not skipped.
+// This option is only used by [WarcFileReader]. An [Unmarshaler] parses and returns records outside the range like
+// any other record.
+func WithDateRange(from, to time.Time) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.dateFrom = from
+		o.dateTo = to
+	})
+}
+
+// WithContentLengthTolerance makes the parser accept a Content-Length which is wrong by up to tolerance bytes.
+//
+// Some tools write a Content-Length which is a few bytes off, making the parser miss the end of the record. With a
+// tolerance, the end of the block is instead found by looking for the end of record marker followed by the next record
+// or the end of input within tolerance bytes of the declared end of the block. The mismatch is reported like other
+// content length mismatches, i.e. as a validation error when SpecViolationPolicy is ErrWarn, and it fails the record
+// when the policy is ErrFail. The tolerance should be kept small, since a block containing an end of record marker
+// followed by 'WARC/' near its end would be cut there.
+//
+// defaults to 0, i.e. Content-Length is trusted
+func WithContentLengthTolerance(tolerance int) WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.contentLengthTolerance = tolerance
+	})
+}
+
+// WithFailFast makes [WarcFileReader.Next] return an error as soon as a record has a validation error.
+//
+// Errors which the error policies report as warnings are normally only collected in the returned Validation. With
+// this option the Validation is also returned as the error, i.e. the error can be inspected with errors.As and a
+// *Validation target. The record is still returned and must be closed by the caller.
+// This option is only used by [WarcFileReader].
+func WithFailFast() WarcRecordOption {
+	return newFuncWarcRecordOption(func(o *warcRecordOptions) {
+		o.failFast = true
+	})
+}
+
+// skipRecord returns true if a record with the given header is outside the date range set by WithDateRange.
+func (o *warcRecordOptions) skipRecord(header *WarcFields) bool {
+	if o.dateFrom.IsZero() && o.dateTo.IsZero() {
+		return false
+	}
+	date, err := header.GetTime(WarcDate)
+	if err != nil {
+		return false
+	}
+	return date.Before(o.dateFrom) || (!o.dateTo.IsZero() && !date.Before(o.dateTo))
+}
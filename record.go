@@ -93,6 +93,14 @@ type WarcRecord interface {
 	//   ErrWarn: all errors found will be added to the Validation.
 	//   ErrFail: the first error is returned and no more validation is done.
 	ValidateDigest(validation *Validation) error
+
+	// ComputeBlockDigest computes the digest of the content block with the given algorithm and sets the
+	// WARC-Block-Digest header field to the computed value.
+	//
+	// If algorithm is the empty string, the algorithm set for WARC-Block-Digest with WithDigests, or else the default
+	// digest algorithm, is used. The block is cached before the digest is
+	// computed, so the content is still available when the record is written.
+	ComputeBlockDigest(algorithm string) (string, error)
 }
 
 // WarcVersion represents a WARC specification version.
@@ -152,6 +160,17 @@ func (rt RecordType) String() string {
 	}
 }
 
+// ParseRecordType returns the RecordType for a WARC-Type value, e.g. "response".
+//
+// The comparison is case-insensitive. An error is returned if the value is not one of the record types defined by
+// the WARC specification.
+func ParseRecordType(s string) (RecordType, error) {
+	if rt := stringToRecordType(strings.ToLower(s)); rt != 0 {
+		return rt, nil
+	}
+	return 0, fmt.Errorf("gowarc: unknown record type: %s", s)
+}
+
 func stringToRecordType(rt string) RecordType {
 	switch rt {
 	case "warcinfo":
@@ -194,10 +213,15 @@ const (
 	Continuation RecordType = 128
 )
 
+// RecordTypes lists all record types defined by the WARC specification.
+var RecordTypes = []RecordType{Warcinfo, Response, Resource, Request, Metadata, Revisit, Conversion, Continuation}
+
 const (
 	// Well known content types
 	ApplicationWarcFields = "application/warc-fields"
 	ApplicationHttp       = "application/http"
+	TextDns               = "text/dns"
+	TextFtpControl        = "text/x-ftp-control-conversation"
 )
 
 const (
@@ -215,6 +239,8 @@ type warcRecord struct {
 	recordType RecordType
 	block      Block
 	closer     func() error
+	// uncompressedSize is the size of the decompressed member when the record is read from a compressed member
+	uncompressedSize int64
 }
 
 func (wr *warcRecord) Version() *WarcVersion { return wr.version }
@@ -422,6 +448,18 @@ func (wr *warcRecord) parseBlock(reader io.Reader, validation *Validation) (err
 				return
 			}
 		}
+		if wr.recordType&(Response|Resource) != 0 {
+			if strings.HasPrefix(contentType, TextDns) {
+				wr.block, err = newDnsBlock(wr.opts, reader, blockDigest, validation)
+				return
+			}
+		}
+		if wr.recordType&(Response|Resource|Metadata) != 0 {
+			if strings.HasPrefix(contentType, TextFtpControl) {
+				wr.block, err = newFtpControlBlock(wr.opts, reader, blockDigest, validation)
+				return
+			}
+		}
 		if wr.recordType == Revisit {
 			wr.block, err = parseRevisitBlock(wr.opts, reader, blockDigest, wr.headers.Get(WarcPayloadDigest))
 			return
@@ -436,6 +474,31 @@ func (wr *warcRecord) parseBlock(reader io.Reader, validation *Validation) (err
 	return
 }
 
+// ComputeBlockDigest computes the digest of the content block with the given algorithm and sets WARC-Block-Digest.
+func (wr *warcRecord) ComputeBlockDigest(algorithm string) (string, error) {
+	defaultAlgorithm, encoding := wr.opts.digestFor(WarcBlockDigest)
+	if algorithm == "" {
+		algorithm = defaultAlgorithm
+	}
+	d, err := newDigest(algorithm, encoding)
+	if err != nil {
+		return "", err
+	}
+	if err := wr.Block().Cache(); err != nil {
+		return "", err
+	}
+	r, err := wr.Block().RawBytes()
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(d, r); err != nil {
+		return "", err
+	}
+	value := d.format()
+	wr.headers.Set(WarcBlockDigest, value)
+	return value, nil
+}
+
 // ValidateDigest validates block and payload digests if present.
 //
 // If option FixDigest is set, an invalid or missing digest will be corrected in the header.
@@ -487,6 +550,16 @@ func (wr *warcRecord) ValidateDigest(validation *Validation) error {
 		blockDigest = v.blockDigest
 	case *warcFieldsBlock:
 		blockDigest = v.blockDigest
+	case *dnsBlock:
+		blockDigest = v.blockDigest
+		if wr.recordType == Resource {
+			payloadDigest = blockDigest
+		}
+	case *ftpControlBlock:
+		blockDigest = v.blockDigest
+		if wr.recordType == Resource {
+			payloadDigest = blockDigest
+		}
 	}
 
 	if blockDigest != nil {
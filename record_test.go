@@ -17,8 +17,11 @@
 package gowarc
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -516,3 +519,64 @@ func createRecord1(recordType RecordType, headers *WarcFields, data string) Warc
 	}
 	return wr
 }
+
+func Test_warcRecord_ComputeBlockDigest(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   []byte
+		algorithm string
+		want      string
+	}{
+		{"empty block", nil, "sha1", "sha1:3I42H3S6NNFQ2MSVX7XZKYAYSCX5QBYJ"},
+		{"default algorithm", []byte("content"), "", "sha1:AQHQN7LXICJEPDKFA52PLORQYXNHRLGI"},
+		{"sha256", []byte("content"), "sha256", "sha256:5VYAFNBZ5GWIIXZCGV6YEK5MCRCHGD55WYAW2PWJIMRJPOPMT5ZQ===="},
+		{"large block", bytes.Repeat([]byte("0123456789abcdef"), 256*1024), "sha1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := NewRecordBuilder(Resource, WithAddMissingDigest(false), WithBufferMaxMemBytes(1024))
+			rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+			rb.AddWarcHeader(ContentType, "application/octet-stream")
+			_, err := rb.Write(tt.content)
+			require.NoError(t, err)
+			record, _, err := rb.Build()
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, record.Close()) }()
+			require.False(t, record.WarcHeader().Has(WarcBlockDigest))
+
+			got, err := record.ComputeBlockDigest(tt.algorithm)
+			require.NoError(t, err)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, got)
+			}
+			assert.Equal(t, got, record.WarcHeader().Get(WarcBlockDigest))
+
+			// The record is still writable and the digest is valid
+			buf := &bytes.Buffer{}
+			_, _, err = NewMarshaler().Marshal(buf, record, 0)
+			require.NoError(t, err)
+			parsed, _, validation, err := NewUnmarshaler(WithSpecViolationPolicy(ErrFail)).Unmarshal(bufio.NewReader(buf))
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, parsed.Close()) }()
+			assert.True(t, validation.Valid(), validation.String())
+			assert.Equal(t, int64(len(tt.content)), parsed.Block().Size())
+		})
+	}
+}
+
+func TestParseRecordType(t *testing.T) {
+	for _, rt := range RecordTypes {
+		got, err := ParseRecordType(rt.String())
+		assert.NoError(t, err)
+		assert.Equal(t, rt, got)
+
+		got, err = ParseRecordType(strings.ToUpper(rt.String()))
+		assert.NoError(t, err)
+		assert.Equal(t, rt, got)
+	}
+
+	_, err := ParseRecordType("unknown")
+	assert.Error(t, err)
+	_, err = ParseRecordType("")
+	assert.Error(t, err)
+}
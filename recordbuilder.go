@@ -17,8 +17,11 @@
 package gowarc
 
 import (
+	"crypto/tls"
 	"io"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nlnwa/gowarc/v2/internal/diskbuffer"
 )
@@ -32,7 +35,13 @@ type WarcRecordBuilder interface {
 	AddWarcHeaderInt(name string, value int)
 	AddWarcHeaderInt64(name string, value int64)
 	AddWarcHeaderTime(name string, value time.Time)
+	SetWarcHeader(name string, value string)
+	WarcHeader() *WarcFields
+	AddTLSConnectionState(state *tls.ConnectionState)
+	SetIdentifiedPayloadType(value string)
+	SetSource(uri string, creationDate time.Time)
 	Build() (WarcRecord, *Validation, error)
+	Validate() *Validation
 	Size() int64
 	SetRecordType(recordType RecordType)
 }
@@ -83,6 +92,63 @@ func (rb *recordBuilder) AddWarcHeaderTime(name string, value time.Time) {
 	rb.headers.AddTime(name, value)
 }
 
+// SetWarcHeader sets the WARC header field with the given name to value, replacing any values added before
+func (rb *recordBuilder) SetWarcHeader(name string, value string) {
+	rb.headers.Set(name, value)
+}
+
+// WarcHeader returns the WARC header fields added so far, e.g. for reading a custom field set by an earlier step in a
+// pipeline
+func (rb *recordBuilder) WarcHeader() *WarcFields {
+	return rb.headers
+}
+
+// AddTLSConnectionState adds WARC-Protocol and WARC-Cipher-Suite header fields describing a TLS connection to the record
+//
+// The negotiated application protocol (e.g. h2) is added before the TLS version (e.g. tls/1.3).
+// Nothing is added if state is nil.
+func (rb *recordBuilder) AddTLSConnectionState(state *tls.ConnectionState) {
+	if state == nil {
+		return
+	}
+	if state.NegotiatedProtocol != "" {
+		rb.headers.Add(WarcProtocol, state.NegotiatedProtocol)
+	}
+	rb.headers.Add(WarcProtocol, strings.ReplaceAll(strings.ToLower(tls.VersionName(state.Version)), " ", "/"))
+	rb.headers.Add(WarcCipherSuite, tls.CipherSuiteName(state.CipherSuite))
+}
+
+// SetSource sets WARC-Source-URI to the URI the record was obtained from, e.g. another archive, and WARC-Creation-Date
+// to the time the record was created. WARC-Date keeps the time of the capture.
+//
+// An existing value is replaced. A field is removed if uri is empty or creationDate is the zero time. Like other URI
+// fields, WARC-Source-URI is validated when the record is built unless SpecViolationPolicy is ErrIgnore.
+func (rb *recordBuilder) SetSource(uri string, creationDate time.Time) {
+	if uri == "" {
+		rb.headers.Delete(WarcSourceURI)
+	} else {
+		rb.headers.Set(WarcSourceURI, uri)
+	}
+	if creationDate.IsZero() {
+		rb.headers.Delete(WarcCreationDate)
+	} else {
+		rb.headers.SetTime(WarcCreationDate, creationDate)
+	}
+}
+
+// SetIdentifiedPayloadType sets WARC-Identified-Payload-Type to the media type of the payload as identified by
+// inspecting its content, e.g. with http.DetectContentType.
+//
+// Parameters are removed and the media type is lower-cased. An existing value is replaced. The field is removed if
+// value is empty.
+func (rb *recordBuilder) SetIdentifiedPayloadType(value string) {
+	if mt := mediaType(value); mt != "" {
+		rb.headers.Set(WarcIdentifiedPayloadType, mt)
+	} else {
+		rb.headers.Delete(WarcIdentifiedPayloadType)
+	}
+}
+
 // Close releases resources used by the WarcRecordBuilder
 // This method should only be used in the case when for some reason the record is not going to be build.
 // Calling Build after Close is an error
@@ -138,6 +204,34 @@ func (rb *recordBuilder) Build() (WarcRecord, *Validation, error) {
 	return wr, validation, err
 }
 
+// Validate checks the headers added so far without building the record.
+//
+// The checks are the same as Build does on the header, e.g. missing mandatory fields for the record type, fields not
+// allowed in the record type and field values with wrong syntax. Every problem is reported in the returned Validation
+// regardless of the error policies. Fields which Build adds, like a missing WARC-Record-ID when WithAddMissingRecordId
+// is set, are not reported as missing. Digests are not checked against the content.
+//
+// The builder is not modified and more headers or content can be added after Validate is called.
+func (rb *recordBuilder) Validate() *Validation {
+	headers := rb.headers.clone()
+	if rb.opts.addMissingRecordId && !headers.Has(WarcRecordID) {
+		// Placeholder for the id generated by Build
+		headers.SetId(WarcRecordID, "urn:uuid:00000000-0000-0000-0000-000000000000")
+	}
+	if rb.opts.addMissingContentLength && !headers.Has(ContentLength) {
+		headers.SetInt64(ContentLength, rb.content.Size())
+	}
+
+	opts := *rb.opts
+	opts.errSpec = ErrWarn
+	opts.errUnknownRecordType = ErrWarn
+	validation := &Validation{}
+	if _, err := validateHeader(headers, rb.version, validation, &opts); err != nil {
+		validation.addError(err)
+	}
+	return validation
+}
+
 func (rb *recordBuilder) validate(wr *warcRecord) (*Validation, error) {
 	size := rb.content.Size()
 	if rb.opts.addMissingContentLength && !wr.WarcHeader().Has(ContentLength) {
@@ -145,6 +239,9 @@ func (rb *recordBuilder) validate(wr *warcRecord) (*Validation, error) {
 	}
 
 	validation := &Validation{}
+	if err := rb.checkTargetURI(validation); err != nil {
+		return validation, err
+	}
 	_, err := validateHeader(rb.headers, wr.version, validation, wr.opts)
 	if err != nil {
 		return validation, err
@@ -153,6 +250,57 @@ func (rb *recordBuilder) validate(wr *warcRecord) (*Validation, error) {
 	return validation, err
 }
 
+// checkTargetURI checks WARC-Target-URI according to the policy set by WithTargetURIPolicy.
+func (rb *recordBuilder) checkTargetURI(validation *Validation) error {
+	if rb.opts.targetURI == TargetURIKeep || !rb.headers.Has(WarcTargetURI) {
+		return nil
+	}
+	uri := rb.headers.Get(WarcTargetURI)
+	if rb.opts.targetURI == TargetURINormalize {
+		uri = percentEncodeURI(uri)
+		rb.headers.Set(WarcTargetURI, uri)
+	}
+
+	// Relative URIs are reported by validateHeader
+	if i := strings.IndexFunc(uri, isIllegalURIChar); i >= 0 {
+		c, _ := utf8.DecodeRuneInString(uri[i:])
+		err := newHeaderFieldErrorf(WarcTargetURI, "illegal character %q in URI: '%s'", c, uri)
+		switch rb.opts.errSpec {
+		case ErrWarn:
+			validation.addError(err)
+		case ErrFail:
+			return err
+		}
+	}
+	return nil
+}
+
+// isIllegalURIChar returns true if c is not allowed anywhere in a URI as defined in RFC 3986.
+func isIllegalURIChar(c rune) bool {
+	return c <= ' ' || c >= 0x7f || strings.ContainsRune("\"<>\\^`{|}", c)
+}
+
+// percentEncodeURI percent-encodes the bytes of uri which are not allowed in a URI. The value is trimmed for
+// surrounding white space first.
+func percentEncodeURI(uri string) string {
+	uri = strings.TrimSpace(uri)
+	if strings.IndexFunc(uri, isIllegalURIChar) < 0 {
+		return uri
+	}
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(uri); i++ {
+		if c := uri[i]; isIllegalURIChar(rune(c)) {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
 // NewRecordBuilder initializes a WarcRecordBuilder used for creating a new record.
 //
 // WarcRecordBuilder implements io.Writer for adding the content block. recordType might be 0, but then SetRecordType or
@@ -174,3 +322,31 @@ func NewRecordBuilder(recordType RecordType, opts ...WarcRecordOption) WarcRecor
 	}
 	return rb
 }
+
+// NewMetadataRecord initializes a WarcRecordBuilder for a metadata record describing the refersTo record.
+//
+// The builder is prepopulated with WARC-Type, WARC-Refers-To, WARC-Target-URI (if present in refersTo) and
+// Content-Type set to 'application/warc-fields'. The caller is expected to write the metadata fields to the builder.
+func NewMetadataRecord(refersTo WarcRecord, opts ...WarcRecordOption) WarcRecordBuilder {
+	rb := NewRecordBuilder(Metadata, opts...)
+	rb.AddWarcHeader(WarcRefersTo, refersTo.WarcHeader().Get(WarcRecordID))
+	if uri := refersTo.WarcHeader().Get(WarcTargetURI); uri != "" {
+		rb.AddWarcHeader(WarcTargetURI, uri)
+	}
+	rb.AddWarcHeader(ContentType, ApplicationWarcFields)
+	return rb
+}
+
+// NewConversionRecord initializes a WarcRecordBuilder for a conversion record holding an alternative version of the
+// content in original, e.g. the result of migrating it to another format.
+//
+// The builder is prepopulated with WARC-Type, WARC-Refers-To and WARC-Target-URI (if present in original). The caller
+// is expected to set Content-Type and write the converted content to the builder.
+func NewConversionRecord(original WarcRecord, opts ...WarcRecordOption) WarcRecordBuilder {
+	rb := NewRecordBuilder(Conversion, opts...)
+	rb.AddWarcHeader(WarcRefersTo, original.WarcHeader().Get(WarcRecordID))
+	if uri := original.WarcHeader().Get(WarcTargetURI); uri != "" {
+		rb.AddWarcHeader(WarcTargetURI, uri)
+	}
+	return rb
+}
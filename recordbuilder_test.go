@@ -17,11 +17,16 @@
 package gowarc
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRecordBuilder(t *testing.T) {
@@ -536,3 +541,276 @@ func TestRecordBuilder_AddWarcHeader(t *testing.T) {
 	assert.ElementsMatch(t, []*nameValue(*expected.WarcHeader()), []*nameValue(*record.WarcHeader()))
 	assert.Equal(t, expectedValidation, validation)
 }
+
+func TestRecordBuilder_SetWarcHeader(t *testing.T) {
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcPageID, "page-1")
+	rb.AddWarcHeader(WarcPageID, "page-2")
+	rb.SetWarcHeader(WarcPageID, "page-3")
+	assert.Equal(t, []string{"page-3"}, rb.WarcHeader().GetAll(WarcPageID))
+	assert.Equal(t, "resource", rb.WarcHeader().Get(WarcType))
+	assert.NoError(t, rb.Close())
+}
+
+func TestRecordBuilder_WithDigests(t *testing.T) {
+	rb := NewRecordBuilder(Response, WithDigests([]DigestSpec{
+		{Field: WarcBlockDigest, Algorithm: "sha1"},
+		{Field: WarcPayloadDigest, Algorithm: "sha256", Encoding: Base16},
+	}))
+	rb.AddWarcHeader(WarcRecordID, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.AddWarcHeader(WarcTargetURI, "http://www.example.com/")
+	rb.AddWarcHeader(ContentType, "application/http;msgtype=response")
+	_, err := rb.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\ncontent")
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	assert.Regexp(t, "^sha1:[A-Z2-7]{32}$", record.WarcHeader().Get(WarcBlockDigest))
+	assert.Equal(t, "sha256:ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+		record.WarcHeader().Get(WarcPayloadDigest))
+
+	validation, err := ValidateRecord(record, WithStrictValidation())
+	require.NoError(t, err)
+	assert.True(t, validation.Valid(), validation)
+}
+
+func TestRecordBuilder_resourcePayloadDigest(t *testing.T) {
+	tests := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", "content"},
+		{TextDns, "20060102150405\r\nexample.com.\t3600\tIN\tA\t93.184.216.34\r\n"},
+		{TextFtpControl, "220 FTP server ready\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			rb := NewRecordBuilder(Resource)
+			rb.AddWarcHeader(WarcRecordID, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+			rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+			rb.AddWarcHeader(WarcTargetURI, "dns:example.com")
+			rb.AddWarcHeader(ContentType, tt.contentType)
+			_, err := rb.WriteString(tt.content)
+			require.NoError(t, err)
+			record, _, err := rb.Build()
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, record.Close()) }()
+
+			// The payload of a resource record is the whole block
+			assert.NotEmpty(t, record.WarcHeader().Get(WarcPayloadDigest))
+			assert.Equal(t, record.WarcHeader().Get(WarcBlockDigest), record.WarcHeader().Get(WarcPayloadDigest))
+
+			validation, err := ValidateRecord(record, WithStrictValidation())
+			require.NoError(t, err)
+			assert.True(t, validation.Valid(), validation)
+		})
+	}
+}
+
+func TestRecordBuilder_Validate(t *testing.T) {
+	rb := NewRecordBuilder(Response, WithStrictValidation(), WithAddMissingRecordId(true))
+	defer func() { _ = rb.Close() }()
+	rb.AddWarcHeader(WarcDate, "2017-03-06")
+	rb.AddWarcHeader(WarcConcurrentTo, "not-an-id")
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+
+	validation := rb.Validate()
+	var messages []string
+	for _, e := range *validation {
+		messages = append(messages, e.Error())
+	}
+	assert.Len(t, messages, 3, validation.String())
+	assert.Contains(t, strings.Join(messages, "\n"), "WARC-Date")
+	assert.Contains(t, strings.Join(messages, "\n"), "WARC-Concurrent-To")
+	assert.Contains(t, strings.Join(messages, "\n"), "missing required field: Content-Type")
+
+	// Validate doesn't change the builder
+	assert.False(t, rb.(*recordBuilder).headers.Has(WarcRecordID))
+	assert.Equal(t, "2017-03-06", rb.(*recordBuilder).headers.Get(WarcDate))
+
+	rb.(*recordBuilder).headers.Set(WarcDate, "2017-03-06T04:03:53Z")
+	rb.(*recordBuilder).headers.Delete(WarcConcurrentTo)
+	rb.AddWarcHeader(ContentType, "text/plain")
+	assert.True(t, rb.Validate().Valid(), rb.Validate().String())
+}
+
+func TestNewMetadataRecord(t *testing.T) {
+	response := createTestRecord()
+	response.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+
+	rb := NewMetadataRecord(response, WithStrictValidation())
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	_, err := rb.WriteString("fetchTimeMs: 42\r\n")
+	assert.NoError(t, err)
+	record, validation, err := rb.Build()
+	assert.NoError(t, err)
+	defer record.Close() //nolint
+
+	assert.True(t, validation.Valid(), validation.String())
+	assert.Equal(t, Metadata, record.Type())
+	assert.Equal(t, response.WarcHeader().Get(WarcRecordID), record.WarcHeader().Get(WarcRefersTo))
+	assert.Equal(t, "http://www.example.com/", record.WarcHeader().Get(WarcTargetURI))
+	assert.Equal(t, ApplicationWarcFields, record.WarcHeader().Get(ContentType))
+	assert.IsType(t, &warcFieldsBlock{}, record.Block())
+	assert.Equal(t, "42", record.Block().(WarcFieldsBlock).WarcFields().Get("fetchTimeMs"))
+}
+
+func TestNewConversionRecord(t *testing.T) {
+	response := createTestRecord()
+	response.WarcHeader().Set(WarcTargetURI, "http://www.example.com/image.gif")
+
+	rb := NewConversionRecord(response, WithStrictValidation())
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.AddWarcHeader(ContentType, "image/png")
+	_, err := rb.WriteString("converted")
+	assert.NoError(t, err)
+	record, validation, err := rb.Build()
+	assert.NoError(t, err)
+	defer record.Close() //nolint
+
+	assert.True(t, validation.Valid(), validation.String())
+	assert.Equal(t, Conversion, record.Type())
+	assert.Equal(t, response.WarcHeader().Get(WarcRecordID), record.WarcHeader().Get(WarcRefersTo))
+	assert.Equal(t, "http://www.example.com/image.gif", record.WarcHeader().Get(WarcTargetURI))
+	assert.Equal(t, "image/png", record.WarcHeader().Get(ContentType))
+}
+
+func TestRecordBuilder_WithTargetURIPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     targetURIPolicy
+		uri        string
+		wantURI    string
+		wantErrMsg string
+	}{
+		{"keep", TargetURIKeep, "http://www.example.com/a b", "http://www.example.com/a b", ""},
+		{"validate valid", TargetURIValidate, "http://www.example.com/a%20b", "http://www.example.com/a%20b", ""},
+		{"validate illegal character", TargetURIValidate, "http://www.example.com/a b", "http://www.example.com/a b", "illegal character ' ' in URI"},
+		{"validate relative", TargetURIValidate, "/index.html", "", "missing a scheme"},
+		{"normalize", TargetURINormalize, " http://www.example.com/a b|ø ", "http://www.example.com/a%20b%7C%C3%B8", ""},
+		{"normalize relative", TargetURINormalize, "index.html", "", "missing a scheme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := NewRecordBuilder(Resource, WithTargetURIPolicy(tt.policy))
+			rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+			rb.AddWarcHeader(ContentType, "text/plain")
+			rb.AddWarcHeader(WarcTargetURI, tt.uri)
+			_, err := rb.WriteString("content")
+			require.NoError(t, err)
+			record, validation, err := rb.Build()
+			require.NoError(t, err)
+			defer record.Close() //nolint
+
+			assert.Equal(t, tt.wantURI, record.WarcHeader().Get(WarcTargetURI))
+			if tt.wantErrMsg == "" {
+				assert.True(t, validation.Valid(), validation.String())
+			} else {
+				require.Len(t, *validation, 1)
+				assert.ErrorContains(t, (*validation)[0], tt.wantErrMsg)
+			}
+		})
+	}
+
+	rb := NewRecordBuilder(Resource, WithTargetURIPolicy(TargetURIValidate), WithStrictValidation())
+	rb.AddWarcHeader(WarcTargetURI, "http://www.example.com/a b")
+	_, _, err := rb.Build()
+	assert.ErrorContains(t, err, "illegal character")
+}
+
+func TestRecordBuilder_AddTLSConnectionState(t *testing.T) {
+	rb := NewRecordBuilder(Resource, WithStrictValidation())
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	rb.AddTLSConnectionState(&tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+	})
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+	record, validation, err := rb.Build()
+	require.NoError(t, err)
+	assert.True(t, validation.Valid(), validation.String())
+
+	// Round trip the record to check that the fields are preserved
+	buf := &bytes.Buffer{}
+	_, _, err = NewMarshaler().Marshal(buf, record, 0)
+	require.NoError(t, err)
+	require.NoError(t, record.Close())
+
+	record, _, validation, err = NewUnmarshaler(WithStrictValidation()).Unmarshal(bufio.NewReader(buf))
+	require.NoError(t, err)
+	defer record.Close() //nolint
+	assert.True(t, validation.Valid(), validation.String())
+	assert.Equal(t, []string{"h2", "tls/1.3"}, record.WarcHeader().GetAll(WarcProtocol))
+	assert.Equal(t, "TLS_AES_128_GCM_SHA256", record.WarcHeader().Get(WarcCipherSuite))
+	assert.Contains(t, record.WarcHeader().String(), "WARC-Cipher-Suite: TLS_AES_128_GCM_SHA256")
+}
+
+func TestRecordBuilder_SetSource(t *testing.T) {
+	rb := NewRecordBuilder(Resource, WithStrictValidation())
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	rb.SetSource("https://archive.example.org/wayback/20060102150405/http://www.example.com/",
+		time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC))
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+	record, validation, err := rb.Build()
+	require.NoError(t, err)
+	assert.True(t, validation.Valid(), validation.String())
+
+	// Round trip the record to check that the fields are preserved
+	buf := &bytes.Buffer{}
+	_, _, err = NewMarshaler().Marshal(buf, record, 0)
+	require.NoError(t, err)
+	require.NoError(t, record.Close())
+
+	record, _, validation, err = NewUnmarshaler(WithStrictValidation()).Unmarshal(bufio.NewReader(buf))
+	require.NoError(t, err)
+	defer record.Close() //nolint
+	assert.True(t, validation.Valid(), validation.String())
+	assert.Contains(t, record.WarcHeader().String(),
+		"WARC-Source-URI: https://archive.example.org/wayback/20060102150405/http://www.example.com/")
+	assert.Contains(t, record.WarcHeader().String(), "WARC-Creation-Date: 2020-03-04T05:06:07Z")
+
+	rb = NewRecordBuilder(Resource, WithStrictValidation())
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.SetSource("not a uri", time.Time{})
+	assert.False(t, rb.WarcHeader().Has(WarcCreationDate))
+	_, _, err = rb.Build()
+	assert.ErrorContains(t, err, WarcSourceURI)
+	rb.SetSource("", time.Time{})
+	assert.False(t, rb.WarcHeader().Has(WarcSourceURI))
+}
+
+func TestRecordBuilder_SetIdentifiedPayloadType(t *testing.T) {
+	rb := NewRecordBuilder(Resource)
+	rb.SetIdentifiedPayloadType("Text/HTML; charset=utf-8")
+	assert.Equal(t, "text/html", rb.(*recordBuilder).headers.Get(WarcIdentifiedPayloadType))
+	rb.SetIdentifiedPayloadType("image/png")
+	assert.Equal(t, []string{"image/png"}, rb.(*recordBuilder).headers.GetAll(WarcIdentifiedPayloadType))
+	rb.SetIdentifiedPayloadType("")
+	assert.False(t, rb.(*recordBuilder).headers.Has(WarcIdentifiedPayloadType))
+	assert.NoError(t, rb.Close())
+}
+
+func TestNewDeterministicIdFunc(t *testing.T) {
+	f1, f2 := NewDeterministicIdFunc("a"), NewDeterministicIdFunc("a")
+	id1, err := f1()
+	require.NoError(t, err)
+	id2, err := f1()
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+	assert.True(t, strings.HasPrefix(id1, "urn:uuid:"), id1)
+
+	id, err := f2()
+	require.NoError(t, err)
+	assert.Equal(t, id1, id)
+	id, err = NewDeterministicIdFunc("b")()
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id)
+}
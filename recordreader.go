@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/nlnwa/gowarc/v2/internal/countingreader"
+)
+
+// NewRecordReader returns a reader of the record stored at offset in r, e.g. a WARC file opened with os.Open.
+//
+// length is the number of bytes the record occupies in the file, e.g. from an offset index or a CDXJ line. If the record
+// is compressed, the reader decompresses it. Only the bytes of the record are read, so a single record is read
+// without decompressing the file from the start. The bytes of an uncompressed record are returned as is.
+//
+// The returned bytes can be parsed with an [Unmarshaler]. Closing the reader does not close r.
+func NewRecordReader(r io.ReaderAt, offset, length int64) (io.ReadCloser, error) {
+	section := io.NewSectionReader(r, offset, length)
+	magic := make([]byte, 4)
+	n, err := section.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(section)
+		if err != nil {
+			return nil, err
+		}
+		gz.Multistream(false)
+		return gz, nil
+	case isBzip2Magic(magic):
+		return io.NopCloser(bzip2.NewReader(section)), nil
+	default:
+		return io.NopCloser(section), nil
+	}
+}
+
+// ReadRecordAt reads the record stored in the byte range from offset with length bytes in the named file.
+//
+// Unlike [NewWarcFileReader], nothing outside the byte range is read, which makes this suitable for looking up a
+// record using an index with offsets and lengths, e.g. the one written by [WithOffsetIndexSidecar]. Compressed records
+// are decompressed. The file is kept open until the returned record is closed.
+//
+// The options and the returned Validation work as for [Unmarshaler].
+func ReadRecordAt(filename string, offset, length int64, opts ...WarcRecordOption) (WarcRecord, *Validation, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	record, _, validation, err := NewUnmarshaler(opts...).Unmarshal(bufio.NewReader(countingreader.NewLimited(f, length)))
+	if err != nil {
+		if record != nil {
+			_ = record.Close()
+		}
+		_ = f.Close()
+		return nil, validation, err
+	}
+	return &fileRecord{WarcRecord: record, file: f}, validation, nil
+}
+
+// fileRecord is a WarcRecord which closes the file it is read from when closed.
+type fileRecord struct {
+	WarcRecord
+	file *os.File
+}
+
+func (r *fileRecord) Close() error {
+	err := r.WarcRecord.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
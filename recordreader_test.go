@@ -0,0 +1,138 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRecordReader(t *testing.T) {
+	ids := []string{
+		"<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>",
+		"<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>",
+	}
+	write := func(compress bool) ([]byte, []int64) {
+		m := NewMemFileSystem()
+		w := NewWarcFileWriter(
+			WithFileSystem(m),
+			WithFileNameGenerator(&PatternNameGenerator{Pattern: "test.warc"}),
+			WithCompression(compress),
+			WithMaxFileSize(0))
+		var offsets []int64
+		for _, id := range ids {
+			record := createTestRecord()
+			record.WarcHeader().Set(WarcRecordID, id)
+			res := w.Write(record)
+			require.NoError(t, res[0].Err)
+			offsets = append(offsets, res[0].FileOffset)
+		}
+		require.NoError(t, w.Close())
+		names := m.Names()
+		require.Len(t, names, 1)
+		b, err := m.ReadFile(names[0])
+		require.NoError(t, err)
+		return b, append(offsets, int64(len(b)))
+	}
+	uncompressed, uncompressedOffsets := write(false)
+	compressed, compressedOffsets := write(true)
+
+	for i, id := range ids {
+		want := uncompressed[uncompressedOffsets[i]:uncompressedOffsets[i+1]]
+		for _, tt := range []struct {
+			name    string
+			file    []byte
+			offsets []int64
+		}{
+			{"uncompressed", uncompressed, uncompressedOffsets},
+			{"compressed", compressed, compressedOffsets},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				r, err := NewRecordReader(bytes.NewReader(tt.file), tt.offsets[i], tt.offsets[i+1]-tt.offsets[i])
+				require.NoError(t, err)
+				got, err := io.ReadAll(r)
+				require.NoError(t, err)
+				assert.NoError(t, r.Close())
+				assert.Equal(t, string(want), string(got))
+
+				r, err = NewRecordReader(bytes.NewReader(tt.file), tt.offsets[i], tt.offsets[i+1]-tt.offsets[i])
+				require.NoError(t, err)
+				record, _, validation, err := NewUnmarshaler().Unmarshal(bufio.NewReader(r))
+				require.NoError(t, err)
+				assert.True(t, validation.Valid(), validation.String())
+				assert.Equal(t, id, record.WarcHeader().Get(WarcRecordID))
+				assert.NoError(t, record.Close())
+				assert.NoError(t, r.Close())
+			})
+		}
+	}
+}
+
+func TestReadRecordAt(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dir := t.TempDir()
+			w := NewWarcFileWriter(
+				WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test.warc"}),
+				WithCompression(compress),
+				WithMaxFileSize(0))
+			var results []WriteResponse
+			for _, id := range []string{"<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>", "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>"} {
+				record := createTestRecord()
+				record.WarcHeader().Set(WarcRecordID, id)
+				res := w.Write(record)
+				require.NoError(t, res[0].Err)
+				results = append(results, res[0])
+			}
+			require.NoError(t, w.Close())
+			filename := filepath.Join(dir, results[0].FileName)
+			fi, err := os.Stat(filename)
+			require.NoError(t, err)
+
+			// Read the first record with the exact length, i.e. without the end of record marker being followed by
+			// the next record
+			record, validation, err := ReadRecordAt(filename, 0, results[1].FileOffset, WithStrictValidation())
+			require.NoError(t, err)
+			assert.True(t, validation.Valid(), validation.String())
+			assert.Equal(t, "<urn:uuid:aaaaaaaa-0221-11e7-adb1-0242ac120008>", record.WarcHeader().Get(WarcRecordID))
+			assert.NoError(t, record.Close())
+
+			record, validation, err = ReadRecordAt(filename, results[1].FileOffset, fi.Size()-results[1].FileOffset)
+			require.NoError(t, err)
+			assert.True(t, validation.Valid(), validation.String())
+			assert.Equal(t, "<urn:uuid:bbbbbbbb-0221-11e7-adb1-0242ac120008>", record.WarcHeader().Get(WarcRecordID))
+			content, err := record.Block().RawBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(content)
+			require.NoError(t, err)
+			assert.Contains(t, string(b), "HTTP/1.1 200 OK")
+			assert.NoError(t, record.Close())
+
+			// The length is too short for the record
+			_, _, err = ReadRecordAt(filename, results[1].FileOffset, 100, WithStrictValidation())
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"hash"
+	"strings"
+)
+
+// RedactionMode decides how [RedactHttpHeaders] redacts a header field.
+type RedactionMode uint8
+
+const (
+	// RedactRemove removes the header field.
+	RedactRemove RedactionMode = iota
+	// RedactHash replaces the value of the header field with an HMAC of the value, keyed with the secret set by
+	// [WithRedactionKey]. Equal values still give equal HMACs, e.g. for seeing that requests share a session.
+	//
+	// Without the key, guesses of a value can't be checked against the HMAC. Anyone holding the key can still confirm
+	// a guessed value, and low-entropy values like Basic credentials or short session ids are easily guessed, so the
+	// key must be kept as secret as the values themselves.
+	RedactHash
+)
+
+// errNoRedactionKey is returned by RedactHttpHeaders for RedactHash without a key.
+var errNoRedactionKey = errors.New("gowarc: RedactHash requires a key, see WithRedactionKey")
+
+// SensitiveHttpHeaders are the HTTP header fields typically holding credentials.
+var SensitiveHttpHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// RedactHttpHeaders returns a copy of record where the HTTP header fields in fieldNames are redacted according to mode.
+//
+// Only request, response and revisit records with an HTTP block are redacted. The HTTP message is re-serialized with
+// the other header lines and the payload left byte for byte as they were, and the record is rebuilt with a new
+// Content-Length and WARC-Block-Digest. The block digest is made with the algorithm of the original digest. The other
+// WARC header fields, including WARC-Record-ID and WARC-Payload-Digest, are kept. The new record is built with opts.
+// With RedactHash the field value is replaced by an HMAC formatted like the WARC digest fields with an 'hmac-' prefix,
+// e.g. 'hmac-sha1:...', made with the same hash algorithm as the block digest and the key set by [WithRedactionKey].
+// An error is returned if no key is set.
+//
+// If no header field is redacted, record is returned as is. Otherwise record is left open and must still be closed by
+// the caller. The block of record is cached, so record can be used after it is redacted.
+func RedactHttpHeaders(record WarcRecord, mode RedactionMode, fieldNames []string, opts ...WarcRecordOption) (WarcRecord, error) {
+	if record.Type()&(Request|Response|Revisit) == 0 {
+		return record, nil
+	}
+	var header []byte
+	switch b := record.Block().(type) {
+	case HttpRequestBlock:
+		header = b.ProtocolHeaderBytes()
+	case HttpResponseBlock:
+		header = b.ProtocolHeaderBytes()
+	case *revisitBlock:
+		if !bytes.HasPrefix(b.headerBytes, []byte("HTTP/")) {
+			return record, nil
+		}
+		header = b.headerBytes
+	default:
+		return record, nil
+	}
+
+	// Keep the algorithm and encoding of the original block digest
+	if v := record.WarcHeader().Get(WarcBlockDigest); v != "" {
+		if d, err := newDigest(v, Base32); err == nil {
+			opts = append([]WarcRecordOption{WithDefaultDigestAlgorithm(d.name), WithDefaultDigestEncoding(d.encoding)}, opts...)
+		}
+	}
+	opts = append([]WarcRecordOption{WithVersion(record.Version())}, opts...)
+	o := newOptions(opts...)
+
+	redacted, changed, err := redactHeaderLines(header, mode, fieldNames, o)
+	if err != nil || !changed {
+		return record, err
+	}
+
+	if err := record.Block().Cache(); err != nil {
+		return nil, err
+	}
+	payload, err := record.Block().(PayloadBlock).PayloadBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	rb := NewRecordBuilder(record.Type(), opts...)
+	for _, nv := range *record.WarcHeader() {
+		switch nv.Name {
+		case WarcType, ContentLength, WarcBlockDigest:
+		default:
+			rb.AddWarcHeader(nv.Name, nv.Value)
+		}
+	}
+	if _, err := rb.Write(redacted); err != nil {
+		_ = rb.Close()
+		return nil, err
+	}
+	if _, err := rb.ReadFrom(payload); err != nil {
+		_ = rb.Close()
+		return nil, err
+	}
+	r, _, err := rb.Build()
+	if err != nil {
+		if r != nil {
+			_ = r.Close()
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewHttpHeaderRedactor returns a function redacting the HTTP header fields in fieldNames with [RedactHttpHeaders].
+// It is meant to be used with [WithRecordTransformer], e.g.
+//
+//	WithRecordTransformer(NewHttpHeaderRedactor(RedactRemove, SensitiveHttpHeaders))
+func NewHttpHeaderRedactor(mode RedactionMode, fieldNames []string, opts ...WarcRecordOption) func(record WarcRecord) (WarcRecord, error) {
+	return func(record WarcRecord) (WarcRecord, error) {
+		return RedactHttpHeaders(record, mode, fieldNames, opts...)
+	}
+}
+
+// redactHeaderLines redacts the fields in fieldNames from the raw HTTP header. The request or status line and the
+// line endings are kept. Continuation lines belong to the field they continue.
+func redactHeaderLines(header []byte, mode RedactionMode, fieldNames []string, o *warcRecordOptions) ([]byte, bool, error) {
+	lines := bytes.SplitAfter(header, []byte("\n"))
+	result := &bytes.Buffer{}
+	result.Write(lines[0])
+	changed := false
+	for i := 1; i < len(lines); i++ {
+		line := lines[i]
+		name, value, found := bytes.Cut(line, []byte(":"))
+		if !found || !isRedacted(string(bytes.TrimSpace(name)), fieldNames) {
+			result.Write(line)
+			continue
+		}
+		changed = true
+		lineEnding := line[len(bytes.TrimRight(line, "\r\n")):]
+		v := bytes.Clone(bytes.TrimSpace(value))
+		for i+1 < len(lines) && len(lines[i+1]) > 0 && (lines[i+1][0] == ' ' || lines[i+1][0] == '\t') {
+			i++
+			v = append(append(v, ' '), bytes.TrimSpace(lines[i])...)
+		}
+		if mode == RedactHash {
+			d, err := newHmacDigest(o.defaultDigestAlgorithm, o.defaultDigestEncoding, o.redactionKey)
+			if err != nil {
+				return nil, false, err
+			}
+			_, _ = d.Write(v)
+			result.Write(name)
+			result.WriteString(": hmac-")
+			result.WriteString(d.format())
+			result.Write(lineEnding)
+		}
+	}
+	return result.Bytes(), changed, nil
+}
+
+// newHmacDigest returns a digest computing the HMAC of the algorithm with key.
+func newHmacDigest(algorithm string, encoding digestEncoding, key []byte) (*digest, error) {
+	if len(key) == 0 {
+		return nil, errNoRedactionKey
+	}
+	d, err := newDigest(algorithm, encoding)
+	if err != nil {
+		return nil, err
+	}
+	d.Hash = hmac.New(func() hash.Hash {
+		h, _ := newDigest(d.name, encoding)
+		return h.Hash
+	}, key)
+	return d, nil
+}
+
+func isRedacted(name string, fieldNames []string) bool {
+	for _, n := range fieldNames {
+		if strings.EqualFold(name, n) {
+			return true
+		}
+	}
+	return false
+}
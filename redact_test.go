@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createRedactTestRecord(t *testing.T, header string) WarcRecord {
+	rb := NewRecordBuilder(Request, WithDefaultDigestAlgorithm("sha256"))
+	rb.AddWarcHeader(WarcRecordID, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.AddWarcHeader(WarcTargetURI, "http://www.example.com/")
+	rb.AddWarcHeader(ContentType, "application/http;msgtype=request")
+	_, err := rb.WriteString(header + "payload")
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	return record
+}
+
+func TestRedactHttpHeaders(t *testing.T) {
+	header := "POST /login HTTP/1.1\r\nHost: www.example.com\r\nCookie: session=secret;\r\n  theme=dark\r\n" +
+		"authorization: Basic dXNlcjpwYXNz\r\nAccept: */*\r\n\r\n"
+
+	tests := []struct {
+		name       string
+		mode       RedactionMode
+		wantHeader string
+	}{
+		{"remove", RedactRemove,
+			"POST /login HTTP/1.1\r\nHost: www.example.com\r\nAccept: */*\r\n\r\n"},
+		{"hash", RedactHash,
+			"POST /login HTTP/1.1\r\nHost: www.example.com\r\n" +
+				"Cookie: hmac-sha256:" + base32HmacSha256("session=secret; theme=dark") + "\r\n" +
+				"authorization: hmac-sha256:" + base32HmacSha256("Basic dXNlcjpwYXNz") + "\r\nAccept: */*\r\n\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := createRedactTestRecord(t, header)
+			defer func() { _ = record.Close() }()
+			payloadDigest := record.WarcHeader().Get(WarcPayloadDigest)
+
+			redacted, err := RedactHttpHeaders(record, tt.mode, SensitiveHttpHeaders, WithRedactionKey(redactionTestKey))
+			require.NoError(t, err)
+			defer func() { _ = redacted.Close() }()
+			assert.NotSame(t, record, redacted)
+
+			block := redacted.Block().(HttpRequestBlock)
+			assert.Equal(t, tt.wantHeader, string(block.ProtocolHeaderBytes()))
+			payload, err := block.PayloadBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(payload)
+			require.NoError(t, err)
+			assert.Equal(t, "payload", string(b))
+
+			assert.Equal(t, record.WarcHeader().Get(WarcRecordID), redacted.WarcHeader().Get(WarcRecordID))
+			assert.Equal(t, payloadDigest, redacted.WarcHeader().Get(WarcPayloadDigest))
+			assert.Regexp(t, "^sha256:", redacted.WarcHeader().Get(WarcBlockDigest))
+			l, err := redacted.WarcHeader().GetInt64(ContentLength)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tt.wantHeader)+len("payload")), l)
+
+			validation, err := ValidateRecord(redacted, WithStrictValidation())
+			require.NoError(t, err)
+			assert.True(t, validation.Valid(), validation)
+
+			// The original record is still readable
+			raw, err := record.Block().RawBytes()
+			require.NoError(t, err)
+			b, err = io.ReadAll(raw)
+			require.NoError(t, err)
+			assert.Equal(t, header+"payload", string(b))
+		})
+	}
+}
+
+func TestRedactHttpHeaders_unchanged(t *testing.T) {
+	record := createRedactTestRecord(t, "GET / HTTP/1.1\r\nHost: www.example.com\r\n\r\n")
+	defer func() { _ = record.Close() }()
+
+	redacted, err := RedactHttpHeaders(record, RedactRemove, SensitiveHttpHeaders)
+	require.NoError(t, err)
+	assert.Same(t, record, redacted)
+
+	response := createTestRecord()
+	redacted, err = NewHttpHeaderRedactor(RedactRemove, []string{"Server"})(response)
+	require.NoError(t, err)
+	defer func() { _ = redacted.Close() }()
+	assert.NotSame(t, response, redacted)
+	assert.Empty(t, redacted.Block().(HttpResponseBlock).HttpHeader().Get("Server"))
+}
+
+func TestRedactHttpHeaders_hashWithoutKey(t *testing.T) {
+	record := createRedactTestRecord(t, "GET / HTTP/1.1\r\nCookie: session=secret\r\n\r\n")
+	defer func() { _ = record.Close() }()
+
+	_, err := RedactHttpHeaders(record, RedactHash, SensitiveHttpHeaders)
+	assert.ErrorIs(t, err, errNoRedactionKey)
+}
+
+var redactionTestKey = []byte("0123456789abcdef0123456789abcdef")
+
+func base32HmacSha256(s string) string {
+	mac := hmac.New(sha256.New, redactionTestKey)
+	mac.Write([]byte(s))
+	return base32.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/nlnwa/gowarc/v2/internal/countingreader"
+)
+
+// ByteRange is a range of bytes in a file. Start is inclusive and End is exclusive.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+var (
+	warcMagic = []byte("WARC/1.")
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+)
+
+// scanChunkSize is the number of bytes read at a time when searching for the start of a record.
+const scanChunkSize = 64 * 1024
+
+// ScanRecords recovers as many intact records as possible from a damaged WARC file.
+//
+// The input is searched for the start of a record, either the WARC version line or a gzip header, and parsing is
+// attempted from each candidate position. Records which are parsed successfully are passed to fn together with
+// their offset. The record is closed when fn returns. If fn returns an error, scanning stops and the error is returned.
+//
+// The byte ranges which could not be parsed as part of any record are returned when the whole input is scanned.
+//
+// By default a record is rejected if it contains syntax errors or violations of the WARC specification, including a
+// wrong digest, since those are typical signs of a damaged record. This can be relaxed with the policy options, but
+// then a damaged record might be accepted and hide the intact record following it.
+func ScanRecords(r io.ReaderAt, size int64, fn func(record WarcRecord, offset int64, validation *Validation) error, opts ...WarcRecordOption) ([]ByteRange, error) {
+	opts = append([]WarcRecordOption{WithSyntaxErrorPolicy(ErrFail), WithSpecViolationPolicy(ErrFail)}, opts...)
+	u := NewUnmarshaler(opts...)
+
+	var unparsed []ByteRange
+	unparsedStart := int64(-1)
+	pos := int64(0)
+	chunk := make([]byte, scanChunkSize)
+	var buf *bufio.Reader
+	for pos < size {
+		candidate, err := nextRecordCandidate(r, size, pos, chunk)
+		if err != nil {
+			return unparsed, err
+		}
+		if candidate > pos && unparsedStart < 0 {
+			unparsedStart = pos
+		}
+		if candidate >= size {
+			break
+		}
+
+		counter := countingreader.New(io.NewSectionReader(r, candidate, size-candidate))
+		if buf == nil {
+			buf = bufio.NewReader(counter)
+		} else {
+			buf.Reset(counter)
+		}
+		record, _, validation, err := u.Unmarshal(buf)
+		if err != nil {
+			if record != nil {
+				_ = record.Close()
+			}
+			if unparsedStart < 0 {
+				unparsedStart = candidate
+			}
+			pos = candidate + 1
+			continue
+		}
+
+		if unparsedStart >= 0 {
+			unparsed = append(unparsed, ByteRange{unparsedStart, candidate})
+			unparsedStart = -1
+		}
+		pos = candidate + counter.N() - int64(buf.Buffered())
+
+		err = fn(record, candidate, validation)
+		_ = record.Close()
+		if err != nil {
+			return unparsed, err
+		}
+	}
+	if unparsedStart >= 0 {
+		unparsed = append(unparsed, ByteRange{unparsedStart, size})
+	}
+	return unparsed, nil
+}
+
+// nextRecordCandidate returns the offset of the first possible start of a record at or after pos.
+// If no candidate is found, size is returned. The chunk of scanChunkSize bytes is used as read buffer so that it can be
+// reused between calls.
+func nextRecordCandidate(r io.ReaderAt, size, pos int64, chunk []byte) (int64, error) {
+	// Overlap chunks to find magic bytes spanning a chunk boundary
+	overlap := int64(len(warcMagic) - 1)
+	for ; pos < size; pos += scanChunkSize - overlap {
+		n, err := r.ReadAt(chunk, pos)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return pos, err
+		}
+		b := chunk[:n]
+		i := bytes.Index(b, warcMagic)
+		if j := bytes.Index(b, gzipMagic); j >= 0 && (i < 0 || j < i) {
+			i = j
+		}
+		if i >= 0 {
+			return pos + int64(i), nil
+		}
+		if int64(n) < scanChunkSize {
+			break
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"uncompressed", false},
+		{"compressed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if tt.compress {
+				gz := gzip.NewWriter(buf)
+				_, _, err := NewMarshaler().Marshal(gz, createTestRecord(), 0)
+				require.NoError(t, err)
+				require.NoError(t, gz.Close())
+			} else {
+				_, _, err := NewMarshaler().Marshal(buf, createTestRecord(), 0)
+				require.NoError(t, err)
+			}
+			record := buf.Bytes()
+
+			// Leading garbage, an intact record, a truncated record and two intact records
+			var data []byte
+			data = append(data, "garbage"...)
+			data = append(data, record...)
+			data = append(data, record[:len(record)/2]...)
+			data = append(data, record...)
+			data = append(data, record...)
+
+			var offsets []int64
+			unparsed, err := ScanRecords(bytes.NewReader(data), int64(len(data)), func(record WarcRecord, offset int64, validation *Validation) error {
+				assert.Equal(t, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>", record.WarcHeader().Get(WarcRecordID))
+				offsets = append(offsets, offset)
+				return nil
+			})
+			require.NoError(t, err)
+
+			r := int64(len(record))
+			assert.Equal(t, []int64{7, 7 + r + r/2, 7 + 2*r + r/2}, offsets)
+			assert.Equal(t, []ByteRange{{0, 7}, {7 + r, 7 + r + r/2}}, unparsed)
+		})
+	}
+}
+
+func TestScanRecords_callbackError(t *testing.T) {
+	buf := &bytes.Buffer{}
+	_, _, err := NewMarshaler().Marshal(buf, createTestRecord(), 0)
+	require.NoError(t, err)
+	_, _, err = NewMarshaler().Marshal(buf, createTestRecord(), 0)
+	require.NoError(t, err)
+
+	stop := errors.New("stop")
+	calls := 0
+	_, err = ScanRecords(bytes.NewReader(buf.Bytes()), int64(buf.Len()), func(WarcRecord, int64, *Validation) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNextRecordCandidate(t *testing.T) {
+	data := make([]byte, 2*scanChunkSize)
+	copy(data[scanChunkSize-3:], warcMagic)
+
+	chunk := make([]byte, scanChunkSize)
+	got, err := nextRecordCandidate(bytes.NewReader(data), int64(len(data)), 0, chunk)
+	require.NoError(t, err)
+	assert.Equal(t, int64(scanChunkSize-3), got)
+
+	got, err = nextRecordCandidate(bytes.NewReader(data), int64(len(data)), scanChunkSize, chunk)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), got)
+}
@@ -19,8 +19,10 @@ package gowarc
 import (
 	"bufio"
 	"bytes"
+	"compress/bzip2"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/klauspost/compress/gzip"
 	"github.com/nlnwa/gowarc/v2/internal/countingreader"
@@ -37,7 +39,18 @@ import (
 //   - The standard error object in Go. If no error occurred during the parsing, this object is nil. Otherwise, it contains details about the encountered error.
 //
 // If the reader contains multiple records, Unmarshal parses the first record and returns.
-// If the reader contains no records, Unmarshal returns an [io.EOF] error.
+// If the reader contains no records, Unmarshal returns an [io.EOF] error. If the reader ends before the WARC version line
+// of a record is read, [ErrUnexpectedEOF] is returned.
+//
+// Unless the syntax error policy is ErrFail, bytes before the start of the record are skipped. A UTF-8 byte order mark
+// is reported with a warning of its own and blank lines are skipped silently. Other bytes are reported with the number
+// of bytes skipped.
+//
+// The record might be compressed as a gzip or bzip2 member, which is detected by its magic bytes. Uncompressed and
+// compressed records might be mixed in the same stream.
+//
+// The Unmarshaler returned by NewUnmarshaler holds no state between calls and is safe for concurrent use, as long as
+// each goroutine reads from its own reader.
 type Unmarshaler interface {
 	Unmarshal(b *bufio.Reader) (WarcRecord, int64, *Validation, error)
 }
@@ -46,7 +59,22 @@ type Unmarshaler interface {
 type unmarshaler struct {
 	opts             *warcRecordOptions
 	warcFieldsParser *warcfieldsParser
-	gz               *gzip.Reader // Holds gzip reader for enabling reuse
+	// discardSkipped is set by WarcFileReader, which discards records outside the range set by WithDateRange, to
+	// avoid parsing and validating their blocks.
+	discardSkipped bool
+}
+
+// utf8BOM is the UTF-8 encoded byte order mark.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// gzipReaderPool holds gzip readers for reuse between records.
+var gzipReaderPool sync.Pool
+
+// gzipBufPool holds the buffered readers used for reading the decompressed content of gzip and bzip2 members.
+var gzipBufPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReader(nil)
+	},
 }
 
 func NewUnmarshaler(opts ...WarcRecordOption) Unmarshaler {
@@ -68,40 +96,73 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (WarcRecord, int64, *Validation
 
 	magic, err := b.Peek(5)
 	if err != nil {
-		return nil, offset, validation, err
+		return nil, offset, validation, eofError(magic, err)
+	}
+	// Some tools add a UTF-8 byte order mark at the start of the file
+	if bytes.HasPrefix(magic, utf8BOM) && u.opts.errSyntax < ErrFail {
+		if u.opts.errSyntax == ErrWarn {
+			validation.addError(newSyntaxError("skipped UTF-8 byte order mark before start of record", &position{}))
+		}
+		if _, err = b.Discard(len(utf8BOM)); err != nil {
+			return nil, offset, validation, err
+		}
+		offset += int64(len(utf8BOM))
+		magic, err = b.Peek(5)
+		if err != nil {
+			return nil, offset, validation, eofError(magic, err)
+		}
 	}
 	// Search for start of new record
-	for !(magic[0] == 0x1f && magic[1] == 0x8b) && !bytes.Equal(magic, []byte("WARC/")) {
+	blankLines := true
+	for !(magic[0] == 0x1f && magic[1] == 0x8b) && !bytes.Equal(magic, []byte("WARC/")) && !isBzip2Magic(magic) {
 		if u.opts.errSyntax >= ErrFail {
 			return nil, offset, validation, newSyntaxError("expected start of record", &position{})
 		}
+		if magic[0] != cr && magic[0] != lf {
+			blankLines = false
+		}
 		if _, err = b.Discard(1); err != nil {
 			return nil, offset, validation, err
 		}
 		offset++
 		magic, err = b.Peek(5)
 		if err != nil {
-			return nil, offset, validation, err
+			return nil, offset, validation, eofError(magic, err)
 		}
 	}
-	if u.opts.errSyntax >= ErrWarn && offset != 0 {
+	// Extra blank lines between records are accepted without warning since some tools write more than the two CRLFs
+	// required to end a record
+	if u.opts.errSyntax >= ErrWarn && offset != 0 && !blankLines {
 		validation.addError(newSyntaxError(
 			fmt.Sprintf("record was found %d bytes after expected offset",
 				offset), &position{}))
 	}
 
+	var gz *gzip.Reader
+	var bz io.Reader
+	var uncompressed *countingreader.Reader
+	isBzip2 := false
 	if magic[0] == 0x1f && magic[1] == 0x8b {
 		isGzip = true
-		if u.gz == nil {
-			u.gz, err = gzip.NewReader(b)
+		if v, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+			gz = v
+			err = gz.Reset(b)
 		} else {
-			err = u.gz.Reset(b)
+			gz, err = gzip.NewReader(b)
 		}
 		if err != nil {
 			return nil, offset, validation, err
 		}
-		u.gz.Multistream(false)
-		r = bufio.NewReader(u.gz)
+		gz.Multistream(false)
+		uncompressed = countingreader.New(gz)
+		r = gzipBufPool.Get().(*bufio.Reader)
+		r.Reset(uncompressed)
+	} else if isBzip2Magic(magic) {
+		isBzip2 = true
+		bz = bzip2.NewReader(&bzip2MemberReader{r: b})
+		uncompressed = countingreader.New(bz)
+		r = gzipBufPool.Get().(*bufio.Reader)
+		r.Reset(uncompressed)
 	} else {
 		r = b
 	}
@@ -111,7 +172,7 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (WarcRecord, int64, *Validation
 	l := make([]byte, 5)
 	i, err := io.ReadFull(r, l)
 	if err != nil {
-		return nil, offset, validation, err
+		return nil, offset, validation, unexpectedEOF(err)
 	}
 	pos.incrLineNumber()
 	if i != 5 || !bytes.Equal(l, []byte("WARC/")) {
@@ -119,7 +180,7 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (WarcRecord, int64, *Validation
 	}
 	l, err = r.ReadBytes('\n')
 	if err != nil {
-		return nil, offset, validation, err
+		return nil, offset, validation, unexpectedEOF(err)
 	}
 	if l[len(l)-2] != '\r' {
 		switch u.opts.errSyntax {
@@ -161,16 +222,29 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (WarcRecord, int64, *Validation
 	}
 
 	length, _ := record.headers.GetInt64(ContentLength)
-	content := countingreader.NewLimited(r, length)
-
-	err = record.parseBlock(bufio.NewReader(content), validation)
-	if err != nil {
-		return record, offset, validation, err
+	var content io.Reader = countingreader.NewLimited(r, length)
+	if u.opts.contentLengthTolerance > 0 {
+		content = &toleratingBlockReader{r: r, length: length, tolerance: int64(u.opts.contentLengthTolerance)}
 	}
 
-	err = record.ValidateDigest(validation)
-	if err != nil {
-		return record, offset, validation, err
+	if u.discardSkipped && u.opts.skipRecord(wf) {
+		// The record will be skipped by the reader, so there is no need to parse or validate the block
+		d, err := newDigest(u.opts.defaultDigestAlgorithm, u.opts.defaultDigestEncoding)
+		if err != nil {
+			return record, offset, validation, err
+		}
+		record.block = newGenericBlock(u.opts, content, d)
+	} else {
+		// Blocks which need a buffered reader, like http blocks, wrap content themselves
+		err = record.parseBlock(content, validation)
+		if err != nil {
+			return record, offset, validation, err
+		}
+
+		err = record.ValidateDigest(validation)
+		if err != nil {
+			return record, offset, validation, err
+		}
 	}
 
 	// Discard any remaining bytes in block not read by parseBlock
@@ -185,12 +259,16 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (WarcRecord, int64, *Validation
 		_, _ = r.Discard(4)
 	} else if len(buf) == 0 {
 		err = fmt.Errorf("too few bytes in end of record marker. Expected %q, was %q", crlfcrlf, buf)
+	} else if n := lfEndOfRecordMarkerLen(buf); n > 0 {
+		err = fmt.Errorf("missing carriage return in end of record marker. Expected %q, was %q", crlfcrlf, buf[:n])
+		_, _ = r.Discard(n)
+	} else if n := singleLineEndingLen(buf); n > 0 {
+		// Some tools separate records with a single line ending. The next record starts right after it.
+		err = fmt.Errorf("missing line ending in end of record marker. Expected %q, was %q", crlfcrlf, buf[:n])
+		_, _ = r.Discard(n)
 	} else if len(buf) == 1 && buf[0] == lf {
 		err = fmt.Errorf("missing carriage return in end of record marker. Expected %q, was %q", crlfcrlf, buf)
 		_, _ = r.Discard(1)
-	} else if len(buf) == 2 && buf[0] == lf && buf[1] == lf {
-		err = fmt.Errorf("missing carriage return in end of record marker. Expected %q, was %q", crlfcrlf, buf)
-		_, _ = r.Discard(2)
 	} else if len(buf) < 4 {
 		err = fmt.Errorf("too few bytes in end of record marker. Expected %q, was %q", crlfcrlf, buf)
 		_, _ = r.Discard(len(buf))
@@ -208,19 +286,150 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (WarcRecord, int64, *Validation
 	}
 	if isGzip {
 		// Empty gzip reader to ensure gzip checksum is validated
-		_, err = io.Copy(io.Discard, u.gz)
-		if err != io.EOF {
-			_ = u.gz.Close()
+		n, err := io.Copy(io.Discard, gz)
+		if err != nil {
+			_ = gz.Close()
 			return record, offset, validation, err
 		}
-		if err := u.gz.Close(); err != nil {
+		record.uncompressedSize = uncompressed.N() + n
+		if err := gz.Close(); err != nil {
 			return record, offset, validation, err
 		}
+		gzipReaderPool.Put(gz)
+		// The content block was either cached or discarded above, so r is no longer referenced
+		r.Reset(nil)
+		gzipBufPool.Put(r)
+	} else if isBzip2 {
+		// Empty bzip2 reader to ensure bzip2 checksum is validated
+		n, err := io.Copy(io.Discard, bz)
+		if err != nil {
+			return record, offset, validation, err
+		}
+		record.uncompressedSize = uncompressed.N() + n
+		r.Reset(nil)
+		gzipBufPool.Put(r)
 	}
 
 	return record, offset, validation, nil
 }
 
+// toleratingBlockReader reads a block with a Content-Length which might be wrong by up to tolerance bytes.
+//
+// The block is read as usual until tolerance bytes before the declared end. The end of the block is then set to the
+// nearest position within tolerance bytes of the declared end which is followed by an end of record marker and the
+// start of the next record or the end of input. If there is no such position, the declared length is used.
+type toleratingBlockReader struct {
+	r         *bufio.Reader
+	length    int64
+	tolerance int64
+	n         int64
+	resolved  bool
+}
+
+func (b *toleratingBlockReader) Read(p []byte) (int, error) {
+	if !b.resolved && b.n >= b.length-b.tolerance {
+		b.resolveLength()
+	}
+	limit := b.length
+	if !b.resolved {
+		limit -= b.tolerance
+	}
+	remaining := limit - b.n
+	if remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// resolveLength sets the length of the block to the nearest record boundary within tolerance bytes of the declared
+// length, preferring the declared length.
+func (b *toleratingBlockReader) resolveLength() {
+	b.resolved = true
+	declared := b.length - b.n
+	window, err := b.r.Peek(int(declared + b.tolerance + int64(len(crlfcrlf)+len("WARC/"))))
+	eof := err == io.EOF
+	isBoundary := func(pos int64) bool {
+		if pos < 0 || pos+int64(len(crlfcrlf)) > int64(len(window)) || string(window[pos:pos+4]) != crlfcrlf {
+			return false
+		}
+		next := window[pos+4:]
+		return (eof && len(next) == 0) || bytes.HasPrefix(next, []byte("WARC/"))
+	}
+	for d := int64(0); d <= b.tolerance; d++ {
+		if isBoundary(declared - d) {
+			b.length -= d
+			return
+		}
+		if d > 0 && isBoundary(declared+d) {
+			b.length += d
+			return
+		}
+	}
+}
+
+// eofError returns the error for reaching the end of input while looking for the start of a record. The remaining
+// bytes are in buf. io.EOF is returned if there is nothing but line endings left, otherwise the input ends in what
+// might be the start of a record and [ErrUnexpectedEOF] is returned.
+func eofError(buf []byte, err error) error {
+	if err == io.EOF && len(bytes.Trim(buf, crlf)) > 0 {
+		return ErrUnexpectedEOF
+	}
+	return err
+}
+
+// unexpectedEOF converts an end of input inside a record to [ErrUnexpectedEOF].
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrUnexpectedEOF
+	}
+	return err
+}
+
+// isBzip2Magic returns true if magic is the start of a bzip2 stream, i.e. 'BZh' followed by the block size.
+func isBzip2Magic(magic []byte) bool {
+	return len(magic) >= 4 && magic[0] == 'B' && magic[1] == 'Z' && magic[2] == 'h' && magic[3] >= '1' && magic[3] <= '9'
+}
+
+// lfEndOfRecordMarkerLen returns the length of an end of record marker where one or both line endings are a bare LF,
+// as written by some broken tools. Zero is returned if buf does not start with two line endings.
+func lfEndOfRecordMarkerLen(buf []byte) int {
+	i := 0
+	for lineEndings := 0; lineEndings < 2; lineEndings++ {
+		switch {
+		case i+1 < len(buf) && buf[i] == cr && buf[i+1] == lf:
+			i += 2
+		case i < len(buf) && buf[i] == lf:
+			i++
+		default:
+			return 0
+		}
+	}
+	return i
+}
+
+// singleLineEndingLen returns the length of the line ending if buf starts with a single line ending followed by
+// something else than a line ending, e.g. the start of the next record. Otherwise zero is returned.
+func singleLineEndingLen(buf []byte) int {
+	n := 0
+	switch {
+	case len(buf) >= 3 && buf[0] == cr && buf[1] == lf:
+		n = 2
+	case len(buf) >= 2 && buf[0] == lf:
+		n = 1
+	default:
+		return 0
+	}
+	if buf[n] == cr || buf[n] == lf {
+		return 0
+	}
+	return n
+}
+
 func (u *unmarshaler) resolveRecordVersion(s string, validation *Validation) (*WarcVersion, error) {
 	switch s {
 	case V1_0.txt:
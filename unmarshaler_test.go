@@ -19,13 +19,17 @@ package gowarc
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"github.com/klauspost/compress/gzip"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func Test_unmarshaler_Unmarshal(t *testing.T) {
@@ -158,7 +162,7 @@ func Test_unmarshaler_Unmarshal(t *testing.T) {
 					&nameValue{Name: ContentType, Value: "text/dns"},
 					&nameValue{Name: ContentLength, Value: "60"},
 				},
-				&genericBlock{},
+				&dnsBlock{},
 				"20191113232334\n" +
 					"ergoterapeutene.org.\t300\tIN\tA\t195.159.29.211\n",
 				&Validation{},
@@ -993,9 +997,320 @@ func BenchmarkUnmarshaler_Unmarshal_compressed(b *testing.B) {
 
 	u := NewUnmarshaler(WithNoValidation())
 
+	b.ReportAllocs()
 	for n := 0; n < b.N; n++ {
 		data := bufio.NewReader(bytes.NewReader(recordCompressed.Bytes()))
 		gotRecord, _, _, _ := u.Unmarshal(data)
 		unmarshallerBenchmarkResult = gotRecord.Close()
 	}
 }
+
+func Test_unmarshaler_Unmarshal_conformanceValidation(t *testing.T) {
+	data := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"WARC-Block-Digest: sha1:7CBE117BFA2B22C3A02DEFF3BC04D5F912964A45\r\n" +
+		"\r\n" +
+		"content\r\n\r\n"
+
+	record, _, validation, err := NewUnmarshaler(WithConformanceValidation()).Unmarshal(bufio.NewReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	defer record.Close() //nolint
+
+	// All errors are collected
+	require.Len(t, *validation, 4)
+	assert.ErrorContains(t, (*validation)[0], "missing carriage return")
+	assert.ErrorContains(t, (*validation)[1], "at header WARC-Date")
+	assert.ErrorContains(t, (*validation)[2], "block: wrong digest")
+	assert.ErrorContains(t, (*validation)[3], "payload: wrong digest")
+
+	// Nothing is fixed
+	assert.Equal(t, "2017-03-06T04:03:53", record.WarcHeader().Get(WarcDate))
+	assert.Equal(t, "sha1:7CBE117BFA2B22C3A02DEFF3BC04D5F912964A45", record.WarcHeader().Get(WarcBlockDigest))
+	assert.False(t, record.WarcHeader().Has(WarcPayloadDigest))
+}
+
+func Test_unmarshaler_Unmarshal_invalidHeaderValue(t *testing.T) {
+	data := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"content\r\n\r\n"
+
+	record, _, validation, err := NewUnmarshaler(WithSpecViolationPolicy(ErrWarn)).Unmarshal(bufio.NewReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	// Without WithConformanceValidation the invalid value is reported and replaced by an empty string
+	require.Len(t, *validation, 1, validation.String())
+	assert.ErrorContains(t, (*validation)[0], "at header WARC-Date")
+	assert.True(t, record.WarcHeader().Has(WarcDate))
+	assert.Equal(t, "", record.WarcHeader().Get(WarcDate))
+}
+
+func Test_unmarshaler_Unmarshal_lfLineEndings(t *testing.T) {
+	data := "WARC/1.1\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\n" +
+		"WARC-Type: response\n" +
+		"Content-Type: application/http;msgtype=response\n" +
+		"Content-Length: 38\n" +
+		"\n" +
+		"HTTP/1.1 200 OK\n" +
+		"Content-Length: 3\n" +
+		"\n" +
+		"abc\n\n"
+
+	t.Run("lenient", func(t *testing.T) {
+		r, err := NewWarcFileReaderFromStream(strings.NewReader(data+data), 0)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, r.Close()) }()
+
+		for _, wantOffset := range []int64{0, int64(len(data))} {
+			record, offset, validation, err := r.Next()
+			require.NoError(t, err)
+			assert.Equal(t, wantOffset, offset)
+			payload, err := record.Block().(HttpResponseBlock).PayloadBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(payload)
+			require.NoError(t, err)
+			assert.Equal(t, "abc", string(b))
+			assert.False(t, validation.Valid())
+			assert.ErrorContains(t, (*validation)[len(*validation)-1], "missing carriage return in end of record marker")
+			assert.NoError(t, record.Close())
+		}
+		_, _, _, err = r.Next()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		_, _, _, err := NewUnmarshaler(WithStrictValidation()).Unmarshal(bufio.NewReader(strings.NewReader(data)))
+		assert.ErrorContains(t, err, "missing carriage return")
+	})
+}
+
+func Test_unmarshaler_Unmarshal_contentLengthTolerance(t *testing.T) {
+	record := func(contentLength int) string {
+		return "WARC/1.1\r\n" +
+			"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+			"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+			"WARC-Type: resource\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"Content-Length: " + strconv.Itoa(contentLength) + "\r\n" +
+			"\r\n" +
+			"content\r\n\r\n"
+	}
+
+	tests := []struct {
+		name          string
+		contentLength int
+		wantErr       string
+	}{
+		{"correct", 7, ""},
+		{"too short", 5, "content length mismatch. header: 5, actual: 7"},
+		{"too long", 10, "content length mismatch. header: 10, actual: 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := record(tt.contentLength)
+			r, err := NewWarcFileReaderFromStream(strings.NewReader(first+record(7)), 0, WithContentLengthTolerance(3))
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, r.Close()) }()
+
+			rec, _, validation, err := r.Next()
+			require.NoError(t, err)
+			if tt.wantErr == "" {
+				assert.True(t, validation.Valid(), validation.String())
+			} else {
+				require.Len(t, *validation, 1, validation.String())
+				assert.EqualError(t, (*validation)[0], tt.wantErr)
+			}
+			content, err := rec.Block().RawBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(content)
+			require.NoError(t, err)
+			assert.Equal(t, "content", string(b))
+			assert.NoError(t, rec.Close())
+
+			rec, offset, validation, err := r.Next()
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(first)), offset)
+			assert.True(t, validation.Valid(), validation.String())
+			assert.NoError(t, rec.Close())
+
+			_, _, _, err = r.Next()
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+
+	t.Run("outside tolerance", func(t *testing.T) {
+		rec, _, _, err := NewUnmarshaler(WithContentLengthTolerance(1)).Unmarshal(bufio.NewReader(strings.NewReader(record(5))))
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, rec.Close()) }()
+		// The declared length is used
+		content, err := rec.Block().RawBytes()
+		require.NoError(t, err)
+		b, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, "conte", string(b))
+	})
+}
+
+func Test_unmarshaler_Unmarshal_singleLineEndingSeparator(t *testing.T) {
+	data := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"content\r\n"
+
+	t.Run("lenient", func(t *testing.T) {
+		r, err := NewWarcFileReaderFromStream(strings.NewReader(data+data+"\r\n"), 0)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, r.Close()) }()
+
+		record, offset, validation, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), offset)
+		require.Len(t, *validation, 1)
+		assert.ErrorContains(t, (*validation)[0], "missing line ending in end of record marker")
+		assert.NoError(t, record.Close())
+
+		// The next record is found without skipping any bytes
+		record, offset, validation, err = r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), offset)
+		assert.True(t, validation.Valid(), validation.String())
+		assert.NoError(t, record.Close())
+
+		_, _, _, err = r.Next()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		_, _, _, err := NewUnmarshaler(WithStrictValidation()).Unmarshal(bufio.NewReader(strings.NewReader(data + data)))
+		assert.ErrorContains(t, err, "missing line ending in end of record marker")
+	})
+}
+
+func Test_unmarshaler_Unmarshal_leadingBOM(t *testing.T) {
+	data := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"content\r\n\r\n"
+
+	t.Run("lenient", func(t *testing.T) {
+		record, offset, validation, err := NewUnmarshaler().Unmarshal(bufio.NewReader(strings.NewReader("\xef\xbb\xbf\r\n\n" + data)))
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, record.Close()) }()
+		assert.Equal(t, int64(6), offset)
+		require.Len(t, *validation, 1, validation.String())
+		assert.ErrorContains(t, (*validation)[0], "skipped UTF-8 byte order mark")
+		assert.Equal(t, Resource, record.Type())
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		_, _, _, err := NewUnmarshaler(WithStrictValidation()).Unmarshal(bufio.NewReader(strings.NewReader("\xef\xbb\xbf" + data)))
+		assert.ErrorContains(t, err, "expected start of record")
+	})
+}
+
+func Test_unmarshaler_Unmarshal_outsideDateRange(t *testing.T) {
+	data := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"content\r\n\r\n"
+
+	u := NewUnmarshaler(WithDateRange(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}))
+	record, _, _, err := u.Unmarshal(bufio.NewReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	// The date range is only used by WarcFileReader, so the record is parsed like any other record
+	r, err := record.Block().RawBytes()
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(b))
+	assert.Equal(t, int64(7), record.Block().Size())
+	assert.Equal(t, "sha1:AQHQN7LXICJEPDKFA52PLORQYXNHRLGI", record.Block().BlockDigest())
+}
+
+func Test_unmarshaler_Unmarshal_concurrent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	z := gzip.NewWriter(buf)
+	_, _, err := NewMarshaler().Marshal(z, createTestRecord(), 0)
+	require.NoError(t, err)
+	require.NoError(t, z.Close())
+	data := buf.Bytes()
+
+	u := NewUnmarshaler()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				record, _, validation, err := u.Unmarshal(bufio.NewReader(bytes.NewReader(data)))
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.True(t, validation.Valid(), validation.String())
+				assert.Equal(t, "sha1:7cbe117bfa2b22c3a02deff3bc04d5f912964a45", record.Block().BlockDigest())
+				assert.NoError(t, record.Close())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_unmarshaler_Unmarshal_bzip2(t *testing.T) {
+	// Two resource records, each compressed as a separate bzip2 stream
+	member1, err := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWS7ngwsAADffgAASQAP/9SwkFJA+5d5gIACSiIm1NBkAAGgBppoDUyAUyeo09Mo0DGkAPUJAHyHilnWbhJAzW648KWmCWpKYxK5GrE1Z30bNmxtomxI3kOCT1ktk0kO2Jh8pYP56AaAcRSKKAFkQUBZrSPU0lmFDK0mMt09t2bAGpYkgLeVsL6DpAPCI4Arfg3QzI3QRWBoXVja3v9j+LuSKcKEgXc8GFg==")
+	require.NoError(t, err)
+	member2, err := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWQPkERUAADjfgAASQAP/9SwkFJA+5d5gIACSEQmmmjRoGgaAA00NBqYUyQ00aemmk0NNP1IABOA91921Y3UiThbRTYd7VGCoVEjErHacTXK3pC57QqE3oLyG9JpWT4LBTHXmYWUsNE8wMwMA0XMAWRBQCNVF6nlvbDSRhVltuzaCr2FEgax+xnkNGAeCTwA/XBug2hDpE5JBPuNA6qFofi7kinChIAfIIio=")
+	require.NoError(t, err)
+
+	r, err := NewWarcFileReaderFromStream(bytes.NewReader(append(append([]byte{}, member1...), member2...)), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	want := []struct {
+		offset int64
+		id     string
+	}{
+		{0, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>"},
+		{int64(len(member1)), "<urn:uuid:e9a0ee48-0221-11e7-adb1-0242ac120008>"},
+	}
+	for _, w := range want {
+		record, offset, validation, err := r.Next()
+		require.NoError(t, err)
+		assert.True(t, validation.Valid(), validation.String())
+		assert.Equal(t, w.offset, offset)
+		assert.Equal(t, w.id, record.WarcHeader().Get(WarcRecordID))
+		content, err := record.Block().RawBytes()
+		require.NoError(t, err)
+		b, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(b))
+		assert.NoError(t, record.Close())
+	}
+	_, _, _, err = r.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
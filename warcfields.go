@@ -17,6 +17,8 @@
 package gowarc
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
@@ -160,16 +162,18 @@ func (wf *WarcFields) AddId(name, value string) {
 func (wf *WarcFields) Set(name string, value string) {
 	name, _ = normalizeName(name)
 	isSet := false
-	for idx, nv := range *wf {
+	result := (*wf)[:0]
+	for _, nv := range *wf {
 		if nv.Name == name {
 			if isSet {
-				*wf = append((*wf)[:idx], (*wf)[idx+1:]...)
-			} else {
-				nv.Value = value
-				isSet = true
+				continue
 			}
+			nv.Value = value
+			isSet = true
 		}
+		result = append(result, nv)
 	}
+	*wf = result
 	if !isSet {
 		*wf = append(*wf, &nameValue{Name: name, Value: value})
 	}
@@ -230,6 +234,71 @@ func (wf *WarcFields) Sort() {
 	})
 }
 
+// Names returns the field names in the order of their first occurrence. A repeated field is only listed once.
+func (wf *WarcFields) Names() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, nv := range *wf {
+		if !seen[nv.Name] {
+			seen[nv.Name] = true
+			names = append(names, nv.Name)
+		}
+	}
+	return names
+}
+
+// Marshal returns the fields in the format used for a record block with content-type "application/warc-fields".
+//
+// An error is returned if a field name is not a valid token or a value contains a line break.
+func (wf *WarcFields) Marshal() ([]byte, error) {
+	for _, nv := range *wf {
+		if !isFieldName(nv.Name) {
+			return nil, fmt.Errorf("gowarc: illegal field name: '%s'", nv.Name)
+		}
+		if strings.ContainsAny(nv.Value, "\r\n") {
+			return nil, fmt.Errorf("gowarc: illegal line break in value of field %s", nv.Name)
+		}
+	}
+	b := &bytes.Buffer{}
+	if _, err := wf.Write(b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal parses data in the format used for a record block with content-type "application/warc-fields" and
+// appends the fields to wf.
+//
+// Lines must be terminated by CRLF. Continuation lines and the ‘encoded-word’ mechanism of [RFC2047] are supported.
+// An error is returned for the first syntax error or invalid field name.
+func (wf *WarcFields) Unmarshal(data []byte) error {
+	p := &warcfieldsParser{&warcRecordOptions{errSyntax: ErrFail}}
+	fields, err := p.Parse(bufio.NewReader(bytes.NewReader(data)), &Validation{}, &position{})
+	if err != nil {
+		return err
+	}
+	for _, nv := range *fields {
+		if !isFieldName(nv.Name) {
+			return fmt.Errorf("gowarc: illegal field name: '%s'", nv.Name)
+		}
+	}
+	*wf = append(*wf, *fields...)
+	return nil
+}
+
+// isFieldName returns true if name is a valid field name, i.e. a token as defined in [RFC2616].
+func isFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("()<>@,;:\\\"/[]?={}", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Write implements the io.Writer interface.
 func (wf *WarcFields) Write(w io.Writer) (bytesWritten int64, err error) {
 	var n int
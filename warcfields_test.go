@@ -483,6 +483,10 @@ func TestWarcFields_Set(t *testing.T) {
 			WarcFields{&nameValue{"Name1", "value1"}, &nameValue{"Name1", "value2"}},
 			"name1", "value3",
 			WarcFields{&nameValue{"Name1", "value3"}}},
+		{"Set existing field with three values",
+			WarcFields{&nameValue{"Name1", "value1"}, &nameValue{"Name2", "value2"}, &nameValue{"Name1", "value3"}, &nameValue{"Name1", "value4"}},
+			"name1", "value5",
+			WarcFields{&nameValue{"Name1", "value5"}, &nameValue{"Name2", "value2"}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -736,3 +740,87 @@ func TestWarcFields_clone(t *testing.T) {
 		})
 	}
 }
+
+func TestWarcFields_Names(t *testing.T) {
+	wf := WarcFields{&nameValue{"Name1", "value1"}, &nameValue{"Name2", "value2"}, &nameValue{"Name1", "value3"}}
+	assert.Equal(t, []string{"Name1", "Name2"}, wf.Names())
+	assert.Empty(t, (&WarcFields{}).Names())
+}
+
+func TestWarcFields_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  WarcFields
+		want    string
+		wantErr string
+	}{
+		{"valid",
+			WarcFields{&nameValue{"Software", "gowarc"}, &nameValue{"Format", "WARC File Format 1.1"}},
+			"Software: gowarc\r\nFormat: WARC File Format 1.1\r\n",
+			""},
+		{"empty", WarcFields{}, "", ""},
+		{"illegal name",
+			WarcFields{&nameValue{"Bad Name", "value"}},
+			"",
+			"gowarc: illegal field name: 'Bad Name'"},
+		{"line break in value",
+			WarcFields{&nameValue{"Name", "foo\r\nbar"}},
+			"",
+			"gowarc: illegal line break in value of field Name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fields.Marshal()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestWarcFields_Unmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    WarcFields
+		wantErr bool
+	}{
+		{"valid",
+			"software: gowarc\r\nformat: WARC File Format 1.1\r\n",
+			WarcFields{&nameValue{"Software", "gowarc"}, &nameValue{"Format", "WARC File Format 1.1"}},
+			false},
+		{"with end marker",
+			"software: gowarc\r\n\r\n",
+			WarcFields{&nameValue{"Software", "gowarc"}},
+			false},
+		{"continuation line",
+			"description: foo\r\n bar\r\n",
+			WarcFields{&nameValue{"Description", "foo bar"}},
+			false},
+		{"missing colon", "software gowarc\r\n", nil, true},
+		{"missing carriage return", "software: gowarc\n", nil, true},
+		{"illegal name", "bad[name]: value\r\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := WarcFields{}
+			err := wf.Unmarshal([]byte(tt.data))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, wf)
+
+			// Round trip
+			b, err := wf.Marshal()
+			assert.NoError(t, err)
+			wf2 := WarcFields{}
+			assert.NoError(t, wf2.Unmarshal(b))
+			assert.Equal(t, wf, wf2)
+		})
+	}
+}
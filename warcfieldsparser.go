@@ -22,13 +22,27 @@ import (
 	"errors"
 	"io"
 	"mime"
+	"sync"
 )
 
 var (
 	colon        = []byte{':'}
+	encodedWord  = []byte("=?")
 	endOfHeaders = errors.New("EOH")
 )
 
+// maxPooledLineBufferSize is the capacity above which a line buffer is not returned to lineBufPool, so that a single
+// huge header doesn't keep memory allocated.
+const maxPooledLineBufferSize = 64 * 1024
+
+// lineBufPool holds scratch buffers for the header lines read by warcfieldsParser.
+var lineBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
 type warcfieldsParser struct {
 	Options *warcRecordOptions
 }
@@ -37,16 +51,18 @@ func (p *warcfieldsParser) parseLine(line []byte, nv WarcFields, pos *position)
 	line = bytes.TrimRight(line, sphtcrlf)
 
 	// Support for ‘encoded-word’ mechanism of [RFC2047]
-	d := mime.WordDecoder{}
-	l, err := d.DecodeHeader(string(line))
-	if err != nil {
-		return nv, newWrappedSyntaxError("error decoding line", pos, err)
+	if bytes.Contains(line, encodedWord) {
+		d := mime.WordDecoder{}
+		l, err := d.DecodeHeader(string(line))
+		if err != nil {
+			return nv, newWrappedSyntaxError("error decoding line", pos, err)
+		}
+		line = []byte(l)
 	}
-	line = []byte(l)
 
 	fv := bytes.SplitN(line, colon, 2)
 	if len(fv) != 2 {
-		err = newSyntaxError("could not parse header line. Missing ':' in "+string(fv[0]), pos)
+		err := newSyntaxError("could not parse header line. Missing ':' in "+string(fv[0]), pos)
 		return nv, err
 	}
 
@@ -57,28 +73,40 @@ func (p *warcfieldsParser) parseLine(line []byte, nv WarcFields, pos *position)
 	return nv, nil
 }
 
-// readLine reads the next line from r.
-// error is returned for syntax error or if r returns an error. If the error is fatal then line is nil.
-// If line is not null it means that readLine was able to get something useful which could be used by a lenient
+// readLine reads the next line from r and appends it to dst, without leading and trailing white space.
+// error is returned for syntax error or if r returns an error. If the error is fatal then nothing is appended.
+// If something is appended it means that readLine was able to get something useful which could be used by a lenient
 // parser even though err was not nil.
 // nextChar returns the first character a new call to readLine would process.
-func (p *warcfieldsParser) readLine(r *bufio.Reader, pos *position) (line []byte, nextChar byte, err error) {
-	line, err = r.ReadBytes('\n')
+func (p *warcfieldsParser) readLine(r *bufio.Reader, pos *position, dst []byte) (line []byte, nextChar byte, err error) {
+	start := len(dst)
+	line = dst
+	for {
+		var frag []byte
+		frag, err = r.ReadSlice('\n')
+		line = append(line, frag...)
+		if err != bufio.ErrBufferFull {
+			break
+		}
+	}
+	raw := line[start:]
+	// The trimmed line is moved to the start of raw, copy handles the overlap
+	trim := func() { line = line[:start+copy(raw, bytes.Trim(raw, sphtcrlf))] }
 	if err != nil {
 		if err == io.EOF {
 			err = endOfHeaders
 		}
-		line = bytes.Trim(line, sphtcrlf)
+		trim()
 		return
 	}
-	if p.Options.errSyntax > ErrIgnore && (len(line) < 2 || line[len(line)-2] != '\r') {
+	if p.Options.errSyntax > ErrIgnore && (len(raw) < 2 || raw[len(raw)-2] != '\r') {
 		err = newSyntaxError("missing carriage return", pos)
 		if p.Options.errSyntax == ErrFail {
-			line = bytes.Trim(line, sphtcrlf)
+			trim()
 			return
 		}
 	}
-	line = bytes.Trim(line, sphtcrlf)
+	trim()
 
 	n, e := r.Peek(1)
 	if e == io.EOF {
@@ -94,8 +122,18 @@ func (p *warcfieldsParser) Parse(r *bufio.Reader, validation *Validation, pos *p
 	wf := WarcFields{}
 	eoh := false
 
+	// Values are copied into strings by parseLine, so the buffer can be reused for every line
+	buf := lineBufPool.Get().(*[]byte)
+	defer func() {
+		if cap(*buf) <= maxPooledLineBufferSize {
+			lineBufPool.Put(buf)
+		}
+	}()
+
 	for {
-		line, nc, err := p.readLine(r, pos.incrLineNumber())
+		line, nc, err := p.readLine(r, pos.incrLineNumber(), (*buf)[:0])
+		// Keep a buffer grown by a long line
+		*buf = line[:0]
 		if err != nil {
 			if err == endOfHeaders {
 				eoh = true
@@ -123,16 +161,15 @@ func (p *warcfieldsParser) Parse(r *bufio.Reader, validation *Validation, pos *p
 
 		// Check for continuation
 		for nc == sp || nc == ht {
-			var l []byte
-			l, nc, err = p.readLine(r, pos.incrLineNumber())
+			n := len(line)
+			line, nc, err = p.readLine(r, pos.incrLineNumber(), append(line, ' '))
+			*buf = line[:0]
 			if err != nil {
-				if l == nil {
+				if len(line) == n+1 {
 					return nil, err
 				}
 				validation.addError(err)
 			}
-			line = append(line, ' ')
-			line = append(line, l...)
 		}
 
 		wf, err = p.parseLine(line, wf, pos)
@@ -19,6 +19,7 @@ package gowarc
 import (
 	"bufio"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"strings"
 	"testing"
 )
@@ -306,3 +307,26 @@ func TestParseWarcFields(t *testing.T) {
 		})
 	}
 }
+
+func TestParseWarcFields_lineBuffer(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	data := "WARC-Target-URI: http://example.com/" + long + "\r\n" +
+		"Subject: first\r\n" +
+		" second\r\n" +
+		"\t=?utf-8?q?third?=\r\n" +
+		"WARC-Type: resource\r\n" +
+		"\r\n"
+
+	// A reader smaller than a line makes lines span several reads
+	r := bufio.NewReaderSize(strings.NewReader(data), 16)
+	p := &warcfieldsParser{Options: newOptions(WithSyntaxErrorPolicy(ErrFail))}
+	validation := &Validation{}
+	got, err := p.Parse(r, validation, &position{})
+	require.NoError(t, err)
+	assert.Equal(t, &WarcFields{
+		&nameValue{Name: WarcTargetURI, Value: "http://example.com/" + long},
+		&nameValue{Name: "Subject", Value: "first second third"},
+		&nameValue{Name: WarcType, Value: "resource"},
+	}, got)
+	assert.True(t, validation.Valid(), validation.String())
+}
@@ -18,11 +18,14 @@ package gowarc
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,7 +36,6 @@ import (
 	"github.com/nlnwa/gowarc/v2/internal"
 	"github.com/nlnwa/gowarc/v2/internal/countingreader"
 	"github.com/nlnwa/gowarc/v2/internal/timestamp"
-	"github.com/prometheus/prometheus/tsdb/fileutil"
 )
 
 // WarcFileNameGenerator is the interface that wraps the NewWarcfileName function.
@@ -42,6 +44,19 @@ type WarcFileNameGenerator interface {
 	NewWarcfileName() (string, string)
 }
 
+// WriterWarcFileNameGenerator is implemented by a WarcFileNameGenerator which takes the concurrent writer creating
+// the file into account.
+//
+// When the name generator of a [WarcFileWriter] implements this interface, NewWarcfileNameForWriter is called instead
+// of NewWarcfileName with the index, starting at 0, of the writer. See [WithMaxConcurrentWriters].
+type WriterWarcFileNameGenerator interface {
+	WarcFileNameGenerator
+
+	// NewWarcfileNameForWriter returns a directory (might be the empty string for current directory) and a file name
+	// for a file created by the writer with the given index.
+	NewWarcfileNameForWriter(writer int) (string, string)
+}
+
 // PatternNameGenerator implements the WarcFileNameGenerator.
 //
 // New filenames are generated based on a pattern which defaults to the recommendation in the WARC 1.1 standard
@@ -50,18 +65,30 @@ type WarcFileNameGenerator interface {
 // The available predefined names are:
 //   - prefix   - content of the Prefix field
 //   - ext      - content of the Extension field
-//   - ts       - current time as 14-digit GMT Time-stamp
+//   - ts       - current time as 14-digit GMT Time-stamp, taken from the Clock field
 //   - serial   - atomically increased serial number for every generated file name. Initial value is 0 if Serial field is not set
+//   - writer   - index of the concurrent writer creating the file, see [WriterWarcFileNameGenerator]
 //   - ip       - primary IP address of the node
 //   - host     - host name of the node
 //   - hostOrIp - host name of the node, falling back to IP address if host name could not be resolved
+//
+// Use [NewPatternNameGenerator] to validate the pattern when the generator is created.
 type PatternNameGenerator struct {
-	Directory string // Directory to store warcfiles. Defaults to the empty string
-	Prefix    string // Prefix available to be used in pattern. Defaults to the empty string
-	Serial    int32  // Serial number available for use in pattern. It is atomically increased with every generated file name.
-	Pattern   string // Pattern for generated file name. Defaults to: "%{prefix}s%{ts}s-%04{serial}d-%{hostOrIp}s.%{ext}s"
-	Extension string // Extension for file name. Defaults to: "warc"
-	params    map[string]interface{}
+	Directory string           // Directory to store warcfiles. Defaults to the empty string
+	Prefix    string           // Prefix available to be used in pattern. Defaults to the empty string
+	Serial    int32            // Serial number available for use in pattern. It is atomically increased with every generated file name.
+	Pattern   string           // Pattern for generated file name. Defaults to: "%{prefix}s%{ts}s-%04{serial}d-%{hostOrIp}s.%{ext}s"
+	Extension string           // Extension for file name. Defaults to: "warc"
+	Clock     func() time.Time // Clock used for the ts parameter. Defaults to the clock of the WarcFileWriter, see WithClock, or time.Now if used alone
+	// SerialPerWriter makes each writer increase its own serial number, starting at the value of Serial, instead of
+	// sharing one. Combined with the writer name this gives gap-free sequential file names per writer.
+	// The pattern must contain the writer name, since concurrent writers would otherwise generate the same names.
+	// NewPatternNameGenerator rejects a pattern without it, otherwise the serial is shared as if SerialPerWriter
+	// was not set.
+	SerialPerWriter bool
+	params          map[string]interface{}
+	perWriter       bool
+	writerSerials   map[int]int32
 }
 
 const (
@@ -69,14 +96,94 @@ const (
 	defaultExtension = "warc"
 )
 
-// Allow overriding of time.Now for tests
-var now = time.Now
+// Allow overriding of host information for tests
 var ip = internal.GetOutboundIP
 var host = internal.GetHostName
 var hostOrIp = internal.GetHostNameOrIP
 
+// patternParams maps the names available in the pattern of a PatternNameGenerator to the verbs accepted for them.
+var patternParams = map[string]string{
+	"prefix":   "sqvxX",
+	"ext":      "sqvxX",
+	"ts":       "sqvxX",
+	"serial":   "bdoxXv",
+	"writer":   "bdoxXv",
+	"ip":       "sqvxX",
+	"host":     "sqvxX",
+	"hostOrIp": "sqvxX",
+}
+
+// NewPatternNameGenerator returns a PatternNameGenerator configured like opts, after validating the pattern.
+//
+// An error is returned if the pattern contains a malformed verb, a name which is not available or a verb which is not
+// accepted for the type of the named value, e.g. %{seral}d or %{serial}s. An error is also returned if SerialPerWriter
+// is set and the pattern doesn't contain the writer name. The zero value of PatternNameGenerator is still usable, but
+// then errors in the pattern are only visible in the generated names.
+func NewPatternNameGenerator(opts PatternNameGenerator) (*PatternNameGenerator, error) {
+	if err := validatePattern(opts.Pattern); err != nil {
+		return nil, err
+	}
+	if opts.SerialPerWriter && !patternHasName(opts.Pattern, "writer") {
+		return nil, fmt.Errorf("gowarc: illegal file name pattern '%s': SerialPerWriter requires the name 'writer'", opts.Pattern)
+	}
+	g := opts
+	return &g, nil
+}
+
+// validatePattern checks that pattern is a valid pattern for PatternNameGenerator. The empty pattern is valid since
+// it is replaced by the default pattern.
+func validatePattern(pattern string) error {
+	verbs, err := internal.ParseNamedVerbs(pattern)
+	if err != nil {
+		return fmt.Errorf("gowarc: illegal file name pattern '%s': %w", pattern, err)
+	}
+	for _, v := range verbs {
+		accepted, ok := patternParams[v.Name]
+		if !ok {
+			return fmt.Errorf("gowarc: illegal file name pattern '%s': unknown name '%s'", pattern, v.Name)
+		}
+		if strings.IndexByte(accepted, v.Verb) < 0 {
+			return fmt.Errorf("gowarc: illegal file name pattern '%s': verb '%%%c' not allowed for '%s'", pattern, v.Verb, v.Name)
+		}
+	}
+	return nil
+}
+
+// patternHasName returns true if pattern, or the default pattern if pattern is empty, contains the name.
+func patternHasName(pattern, name string) bool {
+	if pattern == "" {
+		pattern = defaultPattern
+	}
+	verbs, _ := internal.ParseNamedVerbs(pattern)
+	for _, v := range verbs {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// patternNameGeneratorMu guards the lazy initialization of PatternNameGenerator. A package level mutex keeps the zero
+// value of PatternNameGenerator usable and copyable.
+var patternNameGeneratorMu sync.Mutex
+
 // NewWarcfileName returns a directory (might be the empty string for current directory) and a file name
+//
+// It is safe for concurrent use, e.g. by the concurrent writers of a [WarcFileWriter] sharing the generator. The
+// writer parameter is 0.
 func (g *PatternNameGenerator) NewWarcfileName() (string, string) {
+	return g.NewWarcfileNameForWriter(0)
+}
+
+// NewWarcfileNameForWriter implements WriterWarcFileNameGenerator.
+func (g *PatternNameGenerator) NewWarcfileNameForWriter(writer int) (string, string) {
+	return g.newWarcfileName(writer, nil)
+}
+
+// newWarcfileName generates a name for a file created by the writer with the given index. The time is taken from the
+// Clock field, or from clock if the field is nil. This lets writers sharing the generator use their own clocks.
+func (g *PatternNameGenerator) newWarcfileName(writer int, clock func() time.Time) (string, string) {
+	patternNameGeneratorMu.Lock()
 	if g.Pattern == "" {
 		g.Pattern = defaultPattern
 	}
@@ -91,17 +198,41 @@ func (g *PatternNameGenerator) NewWarcfileName() (string, string) {
 			"host":     host(),
 			"hostOrIp": hostOrIp(),
 		}
+		g.perWriter = g.SerialPerWriter && patternHasName(g.Pattern, "writer")
+	}
+	pattern, params, perWriter := g.Pattern, g.params, g.perWriter
+	var serial int32
+	if perWriter {
+		if g.writerSerials == nil {
+			g.writerSerials = make(map[int]int32)
+		}
+		if _, ok := g.writerSerials[writer]; !ok {
+			g.writerSerials[writer] = atomic.LoadInt32(&g.Serial)
+		}
+		g.writerSerials[writer]++
+		serial = g.writerSerials[writer]
+	}
+	patternNameGeneratorMu.Unlock()
+	if !perWriter {
+		serial = atomic.AddInt32(&g.Serial, 1)
 	}
 
+	if g.Clock != nil {
+		clock = g.Clock
+	}
+	if clock == nil {
+		clock = time.Now
+	}
 	p := map[string]interface{}{
-		"ts":     timestamp.UTC14(now()),
-		"serial": atomic.AddInt32(&g.Serial, 1),
+		"ts":     timestamp.UTC14(clock()),
+		"serial": serial,
+		"writer": writer,
 	}
-	for k, v := range g.params {
+	for k, v := range params {
 		p[k] = v
 	}
 
-	name := internal.Sprintt(g.Pattern, p)
+	name := internal.Sprintt(pattern, p)
 	return g.Directory, name
 }
 
@@ -112,6 +243,9 @@ func (g *PatternNameGenerator) NewWarcfileName() (string, string) {
 // The WarcFileWriter will create a new file when the current file size exceeds the value set by the [WithMaxFileSize] option.
 // File names are generated by the [WarcFileNameGenerator] set by the [WithFileNameGenerator] option.
 // The WarcFileWriter will add a Warcinfo record to each file if the [WithWarcInfoFunc] option is set.
+//
+// Files are written with the suffix set by [WithOpenFileSuffix]. When a file is finished, it is synced to stable storage
+// and atomically renamed to its final name. A file which failed to be written keeps the open file suffix.
 type WarcFileWriter struct {
 	opts        *warcFileWriterOptions
 	writers     []*singleWarcFileWriter
@@ -132,6 +266,24 @@ func NewWarcFileWriter(opts ...WarcFileWriterOption) *WarcFileWriter {
 	for _, opt := range opts {
 		opt.apply(&o)
 	}
+	if p, ok := o.fileSystem.(*preopenedFileSystem); ok {
+		// All records go to the one file
+		p.name = filepath.Base(p.file.Name())
+		if o.compress {
+			p.name = strings.TrimSuffix(p.name, o.compressSuffix)
+		}
+		o.nameGenerator = p
+		o.openFileSuffix = ""
+		o.maxFileSize = 0
+		o.maxFileAge = 0
+		o.maxRecordsPerFile = 0
+		o.idleTimeout = 0
+		o.maxConcurrentWriters = 1
+	}
+	if o.compress && o.singleStreamCompression {
+		// Records in the middle of a gzip stream can't be addressed in the file
+		o.offsetTable = false
+	}
 	w := &WarcFileWriter{opts: &o,
 		closing:     make(chan struct{}), // signal channel
 		closed:      make(chan struct{}),
@@ -168,7 +320,7 @@ func NewWarcFileWriter(opts ...WarcFileWriterOption) *WarcFileWriter {
 	}()
 
 	for i := 0; i < o.maxConcurrentWriters; i++ {
-		writer := &singleWarcFileWriter{opts: &o, shutWriters: w.shutWriters}
+		writer := &singleWarcFileWriter{opts: &o, index: i, shutWriters: w.shutWriters}
 		if o.compress {
 			writer.gz, _ = gzip.NewWriterLevel(nil, o.gzipLevel)
 		}
@@ -180,7 +332,7 @@ func NewWarcFileWriter(opts ...WarcFileWriterOption) *WarcFileWriter {
 
 func worker(w *singleWarcFileWriter, jobs <-chan *job) {
 	defer func() {
-		if err := w.Close(); err != nil {
+		if _, err := w.Close(); err != nil {
 			log.Println(err)
 		}
 		w.shutWriters.Done()
@@ -231,14 +383,7 @@ func (w *WarcFileWriter) Write(record ...WarcRecord) []WriteResponse {
 
 func (w *WarcFileWriter) createWriteJob(record ...WarcRecord) (*job, <-chan []WriteResponse) {
 	if w.opts.addConcurrentHeader {
-		for k, wr := range record {
-			for k2, wr2 := range record {
-				if k == k2 {
-					continue
-				}
-				wr.WarcHeader().AddId(WarcConcurrentTo, wr2.WarcHeader().GetId(WarcRecordID))
-			}
-		}
+		addConcurrentTo(record...)
 	}
 
 	result := make(chan []WriteResponse)
@@ -249,20 +394,76 @@ func (w *WarcFileWriter) createWriteJob(record ...WarcRecord) (*job, <-chan []Wr
 	return job, result
 }
 
+// WriteWarcInfo writes a warcinfo record with the fields as content block to each file currently being written to.
+//
+// This is useful for long-running writers when the information in the warcinfo record changes, e.g. the crawl
+// configuration. Records written to a file afterwards get a WARC-Warcinfo-ID referencing the new warcinfo record. Files
+// created later get a warcinfo record from the function set by [WithWarcInfoFunc] as usual.
+//
+// Returns a slice with one WriteResponse for each file written to. If fields can't be marshaled, the slice holds a
+// single WriteResponse with the error.
+func (w *WarcFileWriter) WriteWarcInfo(fields *WarcFields) []WriteResponse {
+	content, err := fields.Marshal()
+	if err != nil {
+		return []WriteResponse{{Err: err}}
+	}
+	var responses []WriteResponse
+	for _, writer := range w.writers {
+		if res, ok := writer.writeWarcInfo(content); ok {
+			responses = append(responses, res)
+		}
+	}
+	return responses
+}
+
+// FinishedFile describes a WARC file which has been closed and renamed to its final name.
+type FinishedFile struct {
+	Name             string // Path of the file
+	Size             int64  // Size of the file in bytes
+	UncompressedSize int64  // Number of uncompressed bytes written to the file, equal to Size if not compressed
+	WarcInfoId       string // WARC-Record-ID of the last warcinfo record written to the file, if any
+}
+
+// CompressionRatio returns the compression ratio, i.e. compressed size divided by uncompressed size, used for deciding
+// whether a record fits into the current file.
+//
+// The ratio starts at the value set by [WithExpectedCompressionRatio]. Each time a compressed file is finished, the
+// ratio measured for that file is added to a moving average, so files land closer to the max file size as the writer
+// learns how well the content compresses. Each concurrent writer keeps its own average. The mean of them is returned.
+func (w *WarcFileWriter) CompressionRatio() float64 {
+	var sum float64
+	for _, writer := range w.writers {
+		sum += writer.expectedCompressionRatio()
+	}
+	return sum / float64(len(w.writers))
+}
+
 // Rotate closes the current files beeing written to.
 //
 // A call to Write after Rotate creates new files.
 func (w *WarcFileWriter) Rotate() error {
+	_, err := w.RotateFiles()
+	return err
+}
+
+// RotateFiles is like Rotate, but also returns the files which were finished. Writers without an open file are skipped,
+// so the slice is empty if nothing has been written since the last rotation.
+func (w *WarcFileWriter) RotateFiles() ([]FinishedFile, error) {
+	var files []FinishedFile
 	var err multiErr
 	for _, writer := range w.writers {
-		if e := writer.Close(); e != nil {
+		f, e := writer.Close()
+		if e != nil {
 			err = append(err, e)
 		}
+		if f != nil {
+			files = append(files, *f)
+		}
 	}
 	if err != nil {
-		return fmt.Errorf("closing error: %w", err)
+		return files, fmt.Errorf("closing error: %w", err)
 	}
-	return nil
+	return files, nil
 }
 
 // Close closes the current file(s) being written to and then releases all resources used by the WarcFileWriter.
@@ -281,10 +482,21 @@ func (w *WarcFileWriter) Close() error {
 
 type singleWarcFileWriter struct {
 	opts              *warcFileWriterOptions
+	index             int // Index of the writer among the concurrent writers
 	currentFileName   string
-	currentFile       *os.File
+	currentFile       File
 	currentFileSize   int64
 	currentWarcInfoId string
+	currentCdxFile    File
+	currentIdxFile    File
+	fileCreated       time.Time
+	ageTimer          *time.Timer // Closes the current file when it reaches the max file age
+	idleTimer         *time.Timer // Closes the current file when it has not been written to for the idle timeout
+	lastWrite         time.Time
+	uncompressedSize  int64              // Number of uncompressed bytes written to the current file
+	recordCount       int                // Number of records written to the current file by Write
+	offsetTable       []OffsetTableEntry // Records written to the current file, if WithOffsetTable is set
+	compressionRatio  atomic.Uint64      // Bits of the float64 moving average of measured compression ratios, 0 if none
 	writeLock         sync.Mutex
 	shutWriters       *sync.WaitGroup
 	gz                *gzip.Writer // Holds gzip writer, enabling reuse
@@ -294,37 +506,67 @@ func (w *singleWarcFileWriter) Write(record WarcRecord) (response WriteResponse)
 	w.writeLock.Lock()
 	defer w.writeLock.Unlock()
 
+	if len(w.opts.recordTransformers) > 0 {
+		transformed, err := w.transform(record)
+		if err != nil {
+			response.Err = err
+			return
+		}
+		if transformed != record {
+			// Records made by a transformer are owned by the writer
+			defer func() { _ = transformed.Close() }()
+		}
+		record = transformed
+	}
+
 	// Calculate max record size when segmentation is enabled
 	var maxRecordSize int64
 	if w.opts.useSegmentation {
 		if w.opts.compress {
-			maxRecordSize = int64(float64(w.opts.maxFileSize) / w.opts.expectedCompressionRatio)
+			maxRecordSize = int64(float64(w.opts.maxFileSize) / w.expectedCompressionRatio())
 		} else {
 			maxRecordSize = w.opts.maxFileSize
 		}
 	}
 
+	// Check if the current file is too old
+	if w.currentFile != nil && w.opts.maxFileAge > 0 && w.opts.clock().Sub(w.fileCreated) >= w.opts.maxFileAge {
+		if _, err := w.close(); err != nil {
+			response.Err = err
+			return
+		}
+	}
+
+	// Check if the current file has reached the max number of records
+	if w.currentFile != nil && w.opts.maxRecordsPerFile > 0 && w.recordCount >= w.opts.maxRecordsPerFile {
+		if _, err := w.close(); err != nil {
+			response.Err = err
+			return
+		}
+	}
+
 	// Check if the current file has space for the new record
 	if w.currentFile != nil && w.opts.maxFileSize > 0 {
-		s := record.WarcHeader().Get(ContentLength)
-		if s != "" {
-			size, err := strconv.ParseInt(s, 10, 64)
-			if w.opts.compress {
-				// Take compression in account when evaluating if record will fit file
-				size = int64(float64(size) * w.opts.expectedCompressionRatio)
-			}
+		if w.currentWarcInfoId != "" {
+			// Set the WARC-Warcinfo-ID before estimating size since it is part of the record when written
+			record.WarcHeader().SetId(WarcWarcinfoID, w.currentWarcInfoId)
+		}
+		size, err := w.opts.marshaler.EstimateSize(record)
+		if err != nil {
+			response.Err = err
+			return
+		}
+		if w.opts.compress {
+			// Take compression in account when evaluating if record will fit file
+			size = int64(float64(size) * w.expectedCompressionRatio())
+		}
+		if w.currentFileSize > 0 && (w.currentFileSize+size) > w.opts.maxFileSize {
+			// Not enough space in file, close it so a new will be created
+			_, err = w.close()
 			if err != nil {
 				response.Err = err
 				return
 			}
-			if w.currentFileSize > 0 && (w.currentFileSize+size) > w.opts.maxFileSize {
-				// Not enough space in file, close it so a new will be created
-				err = w.close()
-				if err != nil {
-					response.Err = err
-					return
-				}
-			}
 		}
 	}
 
@@ -336,34 +578,131 @@ func (w *singleWarcFileWriter) Write(record WarcRecord) (response WriteResponse)
 		}
 	}
 
-	response.FileOffset = w.currentFileSize
+	if w.opts.rewriteWarcFilename && record.Type() == Warcinfo {
+		record.WarcHeader().Set(WarcFilename, w.currentFileName)
+	}
+
+	response.FileOffset = w.position()
 	response.FileName = w.currentFileName
 	response.BytesWritten, response.Err = w.writeRecord(w.currentFile, record, maxRecordSize)
 	if response.Err != nil {
+		// The file might contain a partially written record
+		w.abandon()
 		return
 	}
 	if w.opts.flush {
 		// sync file to reduce possibility of half written records in case of crash
 		if response.Err = w.currentFile.Sync(); response.Err != nil {
+			w.abandon()
 			return
 		}
 	}
 	fi, err := w.currentFile.Stat()
 	if err != nil {
+		// Without the size of the file, the offset of the next record is unknown
 		response.Err = err
+		w.abandon()
 		return
 	}
+	// The record is in the file, so the state must be updated even if writing the index lines fails
+	length := w.recordLength(response.FileOffset, response.BytesWritten, fi.Size())
 	w.currentFileSize = fi.Size()
+	w.uncompressedSize += response.BytesWritten
+	w.recordCount++
+	w.lastWrite = w.opts.clock()
 
+	if response.Err = w.writeCdx(record, response.FileName, response.FileOffset, length); response.Err != nil {
+		return
+	}
+	response.Err = w.writeIdx(record, response.FileOffset, length)
 	return
 }
 
+// transform applies the transformers set by WithRecordTransformer to record in order. Intermediate records made by
+// a transformer are closed when replaced by the next transformer.
+func (w *singleWarcFileWriter) transform(record WarcRecord) (WarcRecord, error) {
+	result := record
+	for _, transformer := range w.opts.recordTransformers {
+		r, err := transformer(result)
+		if err == nil && r == nil {
+			err = errors.New("gowarc: record transformer returned no record")
+		}
+		if err != nil {
+			if result != record {
+				_ = result.Close()
+			}
+			return nil, err
+		}
+		if result != record && r != result {
+			_ = result.Close()
+		}
+		result = r
+	}
+	return result, nil
+}
+
+// compressionRatioWeight is the weight of the latest measurement in the moving average of compression ratios.
+const compressionRatioWeight = 0.5
+
+// expectedCompressionRatio returns the ratio used for estimating the compressed size of a record. This is the moving
+// average of the ratios measured for finished files, or the value set by WithExpectedCompressionRatio if no file is
+// finished yet.
+func (w *singleWarcFileWriter) expectedCompressionRatio() float64 {
+	if v := w.compressionRatio.Load(); v != 0 {
+		return math.Float64frombits(v)
+	}
+	return w.opts.expectedCompressionRatio
+}
+
+// updateCompressionRatio adds the compression ratio of the current file to the moving average.
+func (w *singleWarcFileWriter) updateCompressionRatio() {
+	if !w.opts.compress || w.uncompressedSize == 0 || w.currentFileSize == 0 {
+		return
+	}
+	ratio := float64(w.currentFileSize) / float64(w.uncompressedSize)
+	if v := w.compressionRatio.Load(); v != 0 {
+		ratio = compressionRatioWeight*ratio + (1-compressionRatioWeight)*math.Float64frombits(v)
+	}
+	w.compressionRatio.Store(math.Float64bits(ratio))
+}
+
+// singleStream returns true if the records of the current file are written to one gzip stream.
+func (w *singleWarcFileWriter) singleStream() bool {
+	return w.opts.compress && w.opts.singleStreamCompression
+}
+
+// position returns the offset of the next record written to the current file. With single stream compression the
+// offset is counted in the uncompressed stream, since records can't be addressed in the compressed file.
+func (w *singleWarcFileWriter) position() int64 {
+	if w.singleStream() {
+		return w.uncompressedSize
+	}
+	return w.currentFileSize
+}
+
+// recordLength returns the length of a record written at offset, given the number of uncompressed bytes written and
+// the size of the file after the record was written.
+func (w *singleWarcFileWriter) recordLength(offset, written, fileSize int64) int64 {
+	if w.singleStream() {
+		return written
+	}
+	return fileSize - offset
+}
+
 func (w *singleWarcFileWriter) createFile() error {
 	var suffix string
 	if w.opts.compress {
 		suffix = w.opts.compressSuffix
 	}
-	dir, fileName := w.opts.nameGenerator.NewWarcfileName()
+	var dir, fileName string
+	switch g := w.opts.nameGenerator.(type) {
+	case *PatternNameGenerator:
+		dir, fileName = g.newWarcfileName(w.index, w.opts.clock)
+	case WriterWarcFileNameGenerator:
+		dir, fileName = g.NewWarcfileNameForWriter(w.index)
+	default:
+		dir, fileName = w.opts.nameGenerator.NewWarcfileName()
+	}
 	fileName += suffix
 	path := dir
 	if path != "" && !strings.HasSuffix(path, "/") {
@@ -374,25 +713,152 @@ func (w *singleWarcFileWriter) createFile() error {
 		_ = w.opts.beforeFileCreationHook(path + fileName)
 	}
 
+	dirPath := path
 	path += fileName + w.opts.openFileSuffix
 
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	file, err := w.opts.fileSystem.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
 	if err != nil {
 		return err
 	}
 	w.currentFileName = fileName
 	w.currentFile = file
+	if w.singleStream() {
+		w.gz.Reset(file)
+	}
+	w.currentFileSize = 0
+	w.uncompressedSize = 0
+	w.recordCount = 0
+	w.offsetTable = nil
+	w.currentWarcInfoId = ""
+	w.fileCreated = w.opts.clock()
+	if w.opts.maxFileAge > 0 {
+		w.ageTimer = time.AfterFunc(w.opts.maxFileAge, func() { w.closeExpired(file) })
+	}
+	w.lastWrite = w.opts.clock()
+	if w.opts.idleTimeout > 0 {
+		w.idleTimer = time.AfterFunc(w.opts.idleTimeout, func() { w.closeIdle(file) })
+	}
+
+	if w.opts.cdxFile {
+		cdxPath := dirPath + cdxFileName(fileName, suffix) + w.opts.openFileSuffix
+		if w.currentCdxFile, err = w.opts.fileSystem.OpenFile(cdxPath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err != nil {
+			w.abandon()
+			return err
+		}
+	}
+	if w.opts.idxFile {
+		idxPath := dirPath + idxFileName(fileName, suffix) + w.opts.openFileSuffix
+		if w.currentIdxFile, err = w.opts.fileSystem.OpenFile(idxPath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err != nil {
+			w.abandon()
+			return err
+		}
+	}
 
 	if w.opts.warcInfoFunc != nil {
 		if _, err := w.createWarcInfoRecord(fileName); err != nil {
+			w.abandon()
+			return err
+		}
+	}
+	return nil
+}
+
+// closeExpired closes file if it is still the current file.
+//
+// It is called by a timer when the file reaches the max file age. There is no caller to return an error to, so it is
+// logged. The same applies to closeIdle.
+func (w *singleWarcFileWriter) closeExpired(file File) {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	if w.currentFile != file {
+		return
+	}
+	if _, err := w.close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// closeIdle closes file if it is still the current file and has not been written to for the idle timeout. Otherwise
+// the idle timer is restarted for the remaining time.
+func (w *singleWarcFileWriter) closeIdle(file File) {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	if w.currentFile != file {
+		return
+	}
+	if remaining := w.opts.idleTimeout - w.opts.clock().Sub(w.lastWrite); remaining > 0 {
+		w.idleTimer.Reset(remaining)
+		return
+	}
+	if _, err := w.close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// stopTimers stops the timers for the current file.
+func (w *singleWarcFileWriter) stopTimers() {
+	if w.ageTimer != nil {
+		w.ageTimer.Stop()
+		w.ageTimer = nil
+	}
+	if w.idleTimer != nil {
+		w.idleTimer.Stop()
+		w.idleTimer = nil
+	}
+}
+
+// writeCdx writes a CDXJ line for the record to the CDX file accompanying the current WARC file and to the CDX writer
+// set by [WithCdxWriter].
+func (w *singleWarcFileWriter) writeCdx(record WarcRecord, fileName string, offset, length int64) error {
+	if w.currentCdxFile == nil && w.opts.cdxWriter == nil {
+		return nil
+	}
+	line, ok, err := cdxjLine(record, w.opts.cdxKeyFunc, w.opts.cdxHeaderFields, fileName, offset, length)
+	if err != nil || !ok {
+		return err
+	}
+	if w.currentCdxFile != nil {
+		if _, err := w.currentCdxFile.Write(line); err != nil {
 			return err
 		}
+		if w.opts.flush {
+			if err := w.currentCdxFile.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+	if w.opts.cdxWriter != nil {
+		return w.opts.cdxWriter.write(line)
+	}
+	return nil
+}
+
+// writeIdx writes an offset index line for the record to the offset index file accompanying the current WARC file and
+// adds the record to the offset table if WithOffsetTable is set.
+func (w *singleWarcFileWriter) writeIdx(record WarcRecord, offset, length int64) error {
+	if w.opts.offsetTable && record.WarcHeader().Get(ContentType) != ApplicationOffsetTable {
+		w.offsetTable = append(w.offsetTable, OffsetTableEntry{Id: record.WarcHeader().GetId(WarcRecordID), Offset: offset, Length: length})
+	}
+	if w.currentIdxFile == nil {
+		return nil
+	}
+	if _, err := w.currentIdxFile.Write(idxLine(record.WarcHeader().GetId(WarcRecordID), offset, length, record.WarcHeader().GetAll(WarcConcurrentTo))); err != nil {
+		return err
+	}
+	if w.opts.flush {
+		return w.currentIdxFile.Sync()
 	}
 	return nil
 }
 
 func (w *singleWarcFileWriter) writeRecord(writer io.Writer, record WarcRecord, maxRecordSize int64) (int64, error) {
-	if w.opts.compress {
+	switch {
+	case w.singleStream():
+		// The gzip stream is started by createFile and ended by close
+		writer = w.gz
+	case w.opts.compress:
 		w.gz.Reset(writer)
 		defer func() { _ = w.gz.Close() }()
 		writer = w.gz
@@ -404,6 +870,12 @@ func (w *singleWarcFileWriter) writeRecord(writer io.Writer, record WarcRecord,
 	if err != nil {
 		return size, err
 	}
+	if w.singleStream() && w.opts.flush {
+		// Push the compressed record to the file to let the following sync persist it
+		if err := w.gz.Flush(); err != nil {
+			return size, err
+		}
+	}
 	if nextRec != nil {
 		res := w.Write(nextRec)
 		res.BytesWritten += size
@@ -414,7 +886,7 @@ func (w *singleWarcFileWriter) writeRecord(writer io.Writer, record WarcRecord,
 
 func (w *singleWarcFileWriter) createWarcInfoRecord(fileName string) (int64, error) {
 	r := NewRecordBuilder(Warcinfo, w.opts.recordOptions...)
-	r.AddWarcHeader(WarcDate, timestamp.UTCW3cIso8601(now()))
+	r.AddWarcHeader(WarcDate, timestamp.UTCW3cIso8601(w.opts.clock()))
 	r.AddWarcHeader(WarcFilename, fileName)
 	r.AddWarcHeader(ContentType, ApplicationWarcFields)
 
@@ -426,11 +898,53 @@ func (w *singleWarcFileWriter) createWarcInfoRecord(fileName string) (int64, err
 	if err != nil {
 		return 0, err
 	}
+	return w.writeWarcInfoRecord(warcinfo)
+}
+
+// writeWarcInfo writes a warcinfo record with the fields as content block to the current file.
+//
+// Records written after the warcinfo record get a WARC-Warcinfo-ID referencing it. Nothing is written and ok is false
+// if there is no open file.
+func (w *singleWarcFileWriter) writeWarcInfo(content []byte) (response WriteResponse, ok bool) {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	if w.currentFile == nil {
+		return response, false
+	}
+
+	r := NewRecordBuilder(Warcinfo, w.opts.recordOptions...)
+	r.AddWarcHeader(WarcDate, timestamp.UTCW3cIso8601(w.opts.clock()))
+	r.AddWarcHeader(WarcFilename, w.currentFileName)
+	r.AddWarcHeader(ContentType, ApplicationWarcFields)
+	if _, response.Err = r.Write(content); response.Err != nil {
+		return response, true
+	}
+	warcinfo, _, err := r.Build()
+	if err != nil {
+		response.Err = err
+		return response, true
+	}
+
+	response.FileOffset = w.position()
+	response.FileName = w.currentFileName
+	if response.BytesWritten, response.Err = w.writeWarcInfoRecord(warcinfo); response.Err != nil {
+		// The file might contain a partially written record
+		w.abandon()
+	}
+	return response, true
+}
+
+// writeWarcInfoRecord writes the warcinfo record to the current file and makes it the warcinfo record referenced by
+// the following records.
+func (w *singleWarcFileWriter) writeWarcInfoRecord(warcinfo WarcRecord) (int64, error) {
 	w.currentWarcInfoId = ""
+	offset := w.position()
 	n, err := w.writeRecord(w.currentFile, warcinfo, 0)
 	if err != nil {
 		return 0, err
 	}
+	w.uncompressedSize += n
 	w.currentWarcInfoId = warcinfo.WarcHeader().GetId(WarcRecordID)
 	if w.opts.flush {
 		// sync file to reduce possibility of half written records in case of crash
@@ -443,13 +957,16 @@ func (w *singleWarcFileWriter) createWarcInfoRecord(fileName string) (int64, err
 		return 0, err
 	}
 	w.currentFileSize = fi.Size()
-	return n, err
+	if err := w.writeIdx(warcinfo, offset, w.recordLength(offset, n, fi.Size())); err != nil {
+		return n, err
+	}
+	return n, nil
 }
 
 // Close closes the current file being written to.
 //
 // It is legal to call Write after close, but then a new file will be opened.
-func (w *singleWarcFileWriter) Close() error {
+func (w *singleWarcFileWriter) Close() (*FinishedFile, error) {
 	w.writeLock.Lock()
 	defer w.writeLock.Unlock()
 	return w.close()
@@ -458,22 +975,120 @@ func (w *singleWarcFileWriter) Close() error {
 // Close closes the current file being written to.
 //
 // It is legal to call Write after close, but then a new file will be opened.
-func (w *singleWarcFileWriter) close() error {
+//
+// To make sure a file without the open file suffix is never corrupt, the file is synced to stable storage before it
+// is closed and then atomically renamed. If a crash occurs before the rename, the only anomaly is a file with the
+// open file suffix.
+//
+// The finished file is returned, or nil if no file was open.
+func (w *singleWarcFileWriter) close() (*FinishedFile, error) {
+	if w.currentFile == nil {
+		return nil, nil
+	}
+	w.stopTimers()
+	if w.opts.offsetTable {
+		err := w.writeOffsetTable()
+		w.offsetTable = nil
+		if err != nil {
+			// The file might contain a partially written record
+			w.abandon()
+			return nil, err
+		}
+	}
+	if w.singleStream() {
+		if err := w.gz.Close(); err != nil {
+			w.abandon()
+			return nil, err
+		}
+		fi, err := w.currentFile.Stat()
+		if err != nil {
+			w.abandon()
+			return nil, err
+		}
+		w.currentFileSize = fi.Size()
+	}
+	f := w.currentFile
+	w.currentFile = nil
+	w.currentFileName = ""
+	if err := w.closeSidecarFiles(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to sync file: %s: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close file: %s: %w", f.Name(), err)
+	}
+	finalFileName := strings.TrimSuffix(f.Name(), w.opts.openFileSuffix)
+	if err := w.opts.fileSystem.Rename(f.Name(), finalFileName); err != nil {
+		return nil, fmt.Errorf("failed to rename file: %s: %w", f.Name(), err)
+	}
+
+	w.updateCompressionRatio()
+
+	if w.opts.afterFileCreationHook != nil {
+		_ = w.opts.afterFileCreationHook(finalFileName, w.currentFileSize, w.currentWarcInfoId)
+	}
+	return &FinishedFile{
+		Name:             finalFileName,
+		Size:             w.currentFileSize,
+		UncompressedSize: w.uncompressedSize,
+		WarcInfoId:       w.currentWarcInfoId,
+	}, nil
+}
+
+// abandon closes the current file without renaming it.
+//
+// This is used when the file might be corrupt, e.g. after a failed write. The file keeps the open file suffix to
+// signal that it was never finalized.
+func (w *singleWarcFileWriter) abandon() {
+	w.stopTimers()
 	if w.currentFile != nil {
-		f := w.currentFile
+		_ = w.currentFile.Close()
 		w.currentFile = nil
 		w.currentFileName = ""
-		if err := f.Close(); err != nil {
-			return fmt.Errorf("failed to close file: %s: %w", f.Name(), err)
-		}
-		finalFileName := strings.TrimSuffix(f.Name(), w.opts.openFileSuffix)
-		if err := fileutil.Rename(f.Name(), finalFileName); err != nil {
-			return fmt.Errorf("failed to rename file: %s: %w", f.Name(), err)
-		}
+	}
+	if w.currentCdxFile != nil {
+		_ = w.currentCdxFile.Close()
+		w.currentCdxFile = nil
+	}
+	if w.currentIdxFile != nil {
+		_ = w.currentIdxFile.Close()
+		w.currentIdxFile = nil
+	}
+}
 
-		if w.opts.afterFileCreationHook != nil {
-			_ = w.opts.afterFileCreationHook(finalFileName, w.currentFileSize, w.currentWarcInfoId)
+// closeSidecarFiles finalizes the CDX and offset index files accompanying the current WARC file.
+//
+// The index files are finalized before the WARC file so that a finalized WARC file always has complete indexes.
+func (w *singleWarcFileWriter) closeSidecarFiles() error {
+	cdx, idx := w.currentCdxFile, w.currentIdxFile
+	w.currentCdxFile, w.currentIdxFile = nil, nil
+	if err := w.closeSidecarFile(cdx); err != nil {
+		if idx != nil {
+			_ = idx.Close()
 		}
+		return err
+	}
+	return w.closeSidecarFile(idx)
+}
+
+// closeSidecarFile syncs, closes and renames a file accompanying the current WARC file. Nothing is done if f is nil.
+func (w *singleWarcFileWriter) closeSidecarFile(f File) error {
+	if f == nil {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync file: %s: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %s: %w", f.Name(), err)
+	}
+	if err := w.opts.fileSystem.Rename(f.Name(), strings.TrimSuffix(f.Name(), w.opts.openFileSuffix)); err != nil {
+		return fmt.Errorf("failed to rename file: %s: %w", f.Name(), err)
 	}
 	return nil
 }
@@ -486,12 +1101,51 @@ type WarcFileReader struct {
 	warcReader     Unmarshaler
 	countingReader *countingreader.Reader
 	bufferedReader *bufio.Reader
+	bufferPool     *ReadBufferPool
+	fileSize       int64
+	records        int64
+	returned       int64
+	opts           *warcRecordOptions
+
+	// Size of the record returned by the last call to Next
+	lastSize             int64
+	lastUncompressedSize int64
+}
+
+// defaultReadBufferSize is the size of the buffers in inputBufPool.
+const defaultReadBufferSize = 1024 * 1024
+
+// inputBufPool is the pool used by readers without [WithReadBufferPool] or [WithReadBufferSize].
+var inputBufPool = NewReadBufferPool(defaultReadBufferSize)
+
+// ReadBufferPool holds the buffered readers used by [WarcFileReader] for reuse when reading many files.
+// Use [NewReadBufferPool] to create a new instance and [WithReadBufferPool] to use it. A ReadBufferPool is safe for
+// concurrent use.
+type ReadBufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewReadBufferPool creates a new [ReadBufferPool] with buffers of the given size.
+func NewReadBufferPool(size int) *ReadBufferPool {
+	p := &ReadBufferPool{size: size}
+	p.pool.New = func() interface{} {
+		return bufio.NewReaderSize(nil, p.size)
+	}
+	return p
+}
+
+// get returns a buffered reader from the pool reading from r.
+func (p *ReadBufferPool) get(r io.Reader) *bufio.Reader {
+	buf := p.pool.Get().(*bufio.Reader)
+	buf.Reset(r)
+	return buf
 }
 
-var inputBufPool = sync.Pool{
-	New: func() interface{} {
-		return bufio.NewReaderSize(nil, 1024*1024)
-	},
+// put returns buf to the pool.
+func (p *ReadBufferPool) put(buf *bufio.Reader) {
+	buf.Reset(nil)
+	p.pool.Put(buf)
 }
 
 // NewWarcFileReader creates a new [WarcFileReader] from the supplied filename.
@@ -517,9 +1171,29 @@ func NewWarcFileReader(filename string, offset int64, opts ...WarcRecordOption)
 // NewWarcFileReaderFromStream creates a new [WarcFileReader] from the supplied io.Reader.
 // The WarcFileReader can be configured with options. See [WarcRecordOption].
 //
+// If offset is > 0 and the reader implements io.Seeker, the reader will seek to that offset. Otherwise the reader is
+// expected to be positioned at offset and offsets returned by Next are relative to this position. This allows for
+// reading from non-seekable streams like pipes and stdin.
+//
+// With [WithSingleStreamDecompression], offset is counted in the decompressed stream and the reader is positioned by
+// decompressing and discarding the data before offset.
+//
 // It is the responsibility of the caller to close the io.Reader.
 func NewWarcFileReaderFromStream(r io.Reader, offset int64, opts ...WarcRecordOption) (*WarcFileReader, error) {
-	if s, ok := r.(io.Seeker); ok {
+	o := newOptions(opts...)
+	src := r
+	if o.singleStreamDecompression {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, gz, offset); err != nil {
+				return nil, err
+			}
+		}
+		src = gz
+	} else if s, ok := r.(io.Seeker); ok && offset > 0 {
 		_, err := s.Seek(offset, 0)
 		if err != nil {
 			return nil, err
@@ -529,13 +1203,27 @@ func NewWarcFileReaderFromStream(r io.Reader, offset int64, opts ...WarcRecordOp
 	wf := &WarcFileReader{
 		file:           r,
 		initialOffset:  offset,
-		warcReader:     NewUnmarshaler(opts...),
-		countingReader: countingreader.New(r),
+		warcReader:     &unmarshaler{opts: o, warcFieldsParser: &warcfieldsParser{o}, discardSkipped: true},
+		countingReader: countingreader.New(src),
+		opts:           o,
+	}
+	// The size of a compressed file can't be compared with offsets in the decompressed stream
+	if f, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok && !o.singleStreamDecompression {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			wf.fileSize = info.Size()
+		}
 	}
 
-	buf := inputBufPool.Get().(*bufio.Reader)
-	buf.Reset(wf.countingReader)
-	wf.bufferedReader = buf
+	switch size := wf.opts.readBufferSize; {
+	case wf.opts.readBufferPool != nil:
+		wf.bufferPool = wf.opts.readBufferPool
+	case size > 0 && size != defaultReadBufferSize:
+		wf.bufferedReader = bufio.NewReaderSize(wf.countingReader, size)
+		return wf, nil
+	default:
+		wf.bufferPool = inputBufPool
+	}
+	wf.bufferedReader = wf.bufferPool.get(wf.countingReader)
 	return wf, nil
 }
 
@@ -556,18 +1244,146 @@ func NewWarcFileReaderFromStream(r io.Reader, offset int64, opts ...WarcRecordOp
 //     [WithSyntaxErrorPolicy], [WithSpecViolationPolicy] and [WithUnknownRecordTypePolicy].
 //     The return values of Next would be a mix of the aforementioned scenarios based on the policies set.
 //
-// When at end of file, returned offset is equal to length of file, WarcRecord is nil and err is [io.EOF].
+// Records outside the range set by [WithDateRange] are skipped. Reading stops at the limits set by [WithReadLimit] and
+// [WithMaxRecords].
+//
+// With [WithFailFast], any error in the Validation is also returned as the error, so the first record which doesn't
+// meet the configured policies stops the reading.
+//
+// When at end of file, returned offset is equal to length of file, WarcRecord is nil and err is [io.EOF]. If the file
+// ends in the middle of a record, err wraps [ErrUnexpectedEOF] instead.
 func (wf *WarcFileReader) Next() (WarcRecord, int64, *Validation, error) {
 	offset := wf.initialOffset + wf.countingReader.N() - int64(wf.bufferedReader.Buffered())
+	if wf.opts.progressFunc != nil && wf.records > 0 {
+		wf.opts.progressFunc(offset, wf.fileSize, wf.records)
+	}
 
-	record, recordOffset, validation, err := wf.warcReader.Unmarshal(wf.bufferedReader)
+	wf.lastSize, wf.lastUncompressedSize = 0, 0
+	for {
+		if wf.opts.readLimit > 0 && offset-wf.initialOffset >= wf.opts.readLimit {
+			return nil, offset, &Validation{}, io.EOF
+		}
+		if wf.opts.maxRecords > 0 && wf.returned >= wf.opts.maxRecords {
+			return nil, offset, &Validation{}, io.EOF
+		}
+		record, recordOffset, validation, err := wf.warcReader.Unmarshal(wf.bufferedReader)
+		if record != nil {
+			wf.records++
+			end := wf.initialOffset + wf.countingReader.N() - int64(wf.bufferedReader.Buffered())
+			wf.lastSize = end - (offset + recordOffset)
+			wf.lastUncompressedSize = wf.lastSize
+			if r, ok := record.(*warcRecord); ok && r.uncompressedSize > 0 {
+				wf.lastUncompressedSize = r.uncompressedSize
+			}
+		}
+		// Skipped records are never returned, so they don't count as returned and their validation errors are ignored
+		skip := err == nil && wf.opts.skipRecord(record.WarcHeader())
+		if record != nil && !skip {
+			wf.returned++
+		}
+		if errors.Is(err, ErrUnexpectedEOF) {
+			return record, offset + recordOffset, validation, fmt.Errorf("%w in record at offset %d", err, offset+recordOffset)
+		}
+		if !skip {
+			if err == nil && wf.opts.failFast && validation != nil && !validation.Valid() {
+				return record, offset + recordOffset, validation, validation
+			}
+			return record, offset + recordOffset, validation, err
+		}
+		if err := record.Close(); err != nil {
+			return nil, offset + recordOffset, validation, err
+		}
+		offset = wf.initialOffset + wf.countingReader.N() - int64(wf.bufferedReader.Buffered())
+	}
+}
 
-	return record, offset + recordOffset, validation, err
+// LastRecordSize returns the size of the record returned by the last call to Next.
+//
+// size is the number of bytes the record occupies in the file, from the offset returned by Next to the start of the
+// next record. This is the length to use together with the offset for reading the record again, e.g. with
+// [ReadRecordAt]. If the record is compressed, uncompressedSize is the size of the decompressed member, otherwise it is
+// equal to size. Both are 0 if no record was returned.
+func (wf *WarcFileReader) LastRecordSize() (size, uncompressedSize int64) {
+	return wf.lastSize, wf.lastUncompressedSize
+}
+
+// RecordResult holds the values returned by [WarcFileReader.Next] for a record sent by [WarcFileReader.Stream].
+type RecordResult struct {
+	Record     WarcRecord
+	Offset     int64
+	Validation *Validation
+	Err        error
+}
+
+// Stream reads the records in a goroutine and sends them on the returned channel.
+//
+// The channel has a single consumer. Each record must be closed by the consumer before the next record is read, so
+// the goroutine doesn't read ahead of the consumer. Reading stops and the channel is closed at end of file, after a
+// result with an error other than io.EOF is sent, or when ctx is canceled. A record which is read, but not received
+// before ctx is canceled, is closed by the goroutine.
+//
+// Next must not be called while streaming. The WarcFileReader is not closed when the channel is closed.
+// An error is returned if ctx is already canceled.
+func (wf *WarcFileReader) Stream(ctx context.Context) (<-chan RecordResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan RecordResult)
+	go func() {
+		defer close(ch)
+		for {
+			record, offset, validation, err := wf.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			var closed chan struct{}
+			if record != nil {
+				closed = make(chan struct{})
+				record = &streamRecord{WarcRecord: record, closed: closed}
+			}
+
+			select {
+			case ch <- RecordResult{Record: record, Offset: offset, Validation: validation, Err: err}:
+			case <-ctx.Done():
+				if record != nil {
+					_ = record.Close()
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			select {
+			case <-closed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// streamRecord is a WarcRecord sent by Stream which signals the reading goroutine when closed.
+type streamRecord struct {
+	WarcRecord
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (r *streamRecord) Close() error {
+	err := r.WarcRecord.Close()
+	r.once.Do(func() { close(r.closed) })
+	return err
 }
 
 // Close closes the WarcFileReader.
 func (wf *WarcFileReader) Close() error {
-	inputBufPool.Put(wf.bufferedReader)
+	if wf.bufferPool != nil {
+		wf.bufferPool.put(wf.bufferedReader)
+		wf.bufferPool = nil
+	}
 	if wf.file != nil {
 		if c, ok := wf.file.(io.Closer); ok {
 			return c.Close()
@@ -594,6 +1410,20 @@ type warcFileWriterOptions struct {
 	beforeFileCreationHook   func(fileName string) error
 	afterFileCreationHook    func(fileName string, size int64, warcInfoId string) error
 	recordOptions            []WarcRecordOption
+	recordTransformers       []func(record WarcRecord) (WarcRecord, error)
+	fileSystem               FileSystem
+	cdxWriter                *cdxWriter
+	cdxFile                  bool
+	cdxKeyFunc               func(uri string) string
+	cdxHeaderFields          []string
+	idxFile                  bool
+	offsetTable              bool
+	singleStreamCompression  bool
+	rewriteWarcFilename      bool
+	maxFileAge               time.Duration
+	maxRecordsPerFile        int
+	idleTimeout              time.Duration
+	clock                    func() time.Time
 }
 
 func (w *warcFileWriterOptions) String() string {
@@ -635,6 +1465,9 @@ func defaultwarcFileWriterOptions() warcFileWriterOptions {
 		maxConcurrentWriters:     1,
 		addConcurrentHeader:      false,
 		recordOptions:            []WarcRecordOption{},
+		fileSystem:               osFileSystem{},
+		cdxKeyFunc:               Surt,
+		clock:                    time.Now,
 	}
 }
 
@@ -647,6 +1480,176 @@ func WithMaxFileSize(size int64) WarcFileWriterOption {
 	})
 }
 
+// WithMaxRecordsPerFile sets the max number of records in a Warc file before creating a new one.
+//
+// Only records passed to Write are counted, not the warcinfo record added by the function set with
+// [WithWarcInfoFunc]. A value of 0 means no limit.
+//
+// defaults to 0
+func WithMaxRecordsPerFile(n int) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.maxRecordsPerFile = n
+	})
+}
+
+// WithMaxFileAge sets the max time a Warc file is kept open before creating a new one.
+//
+// The age is checked before each write. A file which is not written to is closed by a timer when it reaches the max
+// age, so that an idle writer does not keep a file open until the next write. A value of 0 means no limit.
+//
+// defaults to 0
+func WithMaxFileAge(d time.Duration) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.maxFileAge = d
+	})
+}
+
+// WithIdleTimeout sets the time after the last write when an open Warc file is closed.
+//
+// This makes files available to readers when records arrive in bursts. The next write creates a new file as usual.
+// A value of 0 means that files are kept open until they are full or the writer is closed.
+//
+// defaults to 0
+func WithIdleTimeout(d time.Duration) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.idleTimeout = d
+	})
+}
+
+// WithClock sets the clock used for the WARC-Date of warcinfo records, for the age of files, see [WithMaxFileAge], for
+// the time since the last write, see [WithIdleTimeout], and for the ts parameter of a [PatternNameGenerator] which has
+// no clock of its own. The generator is not changed, so writers sharing it use their own clocks.
+//
+// This makes it possible to write reproducible WARC files in tests. Timers closing idle or old files still fire on
+// real time, but an idle file is only closed when the clock shows that the idle timeout has passed. A clock which
+// doesn't advance therefore keeps idle files open.
+//
+// defaults to time.Now
+func WithClock(clock func() time.Time) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.clock = clock
+	})
+}
+
+// WithFile makes the writer write to a file opened by the caller instead of creating files, e.g. an *os.File made with
+// os.NewFile from a file descriptor handed to a sandboxed process.
+//
+// Every record is written to f and f is closed when the writer is closed. Since there is only one file, the options
+// for rotating files, like [WithMaxFileSize] and [WithMaxFileAge], as well as the file name generator, the open file
+// suffix and the number of concurrent writers are ignored. Writes after the file is closed, e.g. by
+// [WarcFileWriter.Rotate], fail. The name of f is used as the WARC file name, e.g. in the warcinfo record. Index files
+// written with [WithCdxFile] or [WithOffsetIndexSidecar] can't be created, but [WithCdxWriter] works.
+func WithFile(f File) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.fileSystem = &preopenedFileSystem{file: f}
+	})
+}
+
+// WithFileSystem sets the FileSystem used for creating and renaming WARC files.
+//
+// Use a [MemFileSystem] to write WARC files to memory, e.g. for tests and benchmarks.
+//
+// defaults to the operating system's file system
+func WithFileSystem(fs FileSystem) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.fileSystem = fs
+	})
+}
+
+// WithCdxWriter sets a writer for a CDXJ index of the records written.
+//
+// A CDXJ line with the SURT of the target URI (see [WithCdxKeyFunc]), timestamp, URI, media type, status, digest, length, offset and file name
+// is written to w for every response, resource, revisit, metadata and conversion record having a WARC-Target-URI.
+// Lines are written in the order records are written, so the index might need to be sorted before use.
+// Writes to w are serialized when using more than one concurrent writer. If w has a Flush method, e.g. a bufio.Writer,
+// it is flushed after each line so that a crash leaves only whole lines.
+//
+// defaults to no index
+func WithCdxWriter(w io.Writer) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.cdxWriter = &cdxWriter{w: w}
+	})
+}
+
+// WithCdxKeyFunc sets the function making the key of a CDXJ line from the WARC-Target-URI of a record.
+//
+// The key is the first field of the lines written by [WithCdxWriter] and [WithCdxFile]. Use this to canonicalize URIs
+// according to local conventions. The same function should be used when making keys for lookups in the index.
+//
+// defaults to [Surt]
+func WithCdxKeyFunc(keyFunc func(uri string) string) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.cdxKeyFunc = keyFunc
+	})
+}
+
+// WithCdxHeaderFields adds the values of WARC header fields to the JSON block of the CDXJ lines written by
+// [WithCdxWriter] and [WithCdxFile], e.g. WARC-Page-ID for looking up all records belonging to a page.
+//
+// The field name is used as key. Fields which are not present in a record are left out of its line.
+func WithCdxHeaderFields(names ...string) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.cdxHeaderFields = names
+	})
+}
+
+// WithCdxFile sets if writer should write a CDXJ index next to each WARC file.
+//
+// The index file gets the name of the WARC file with the extension replaced by .cdxj, e.g. foo.warc.gz is indexed in
+// foo.cdxj. The index file has the open file suffix while being written and is finalized just before the WARC file.
+// See [WithCdxWriter] for the content of the index.
+//
+// defaults to false
+func WithCdxFile(cdxFile bool) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.cdxFile = cdxFile
+	})
+}
+
+// WithOffsetIndexSidecar sets if writer should write an offset index next to each WARC file.
+//
+// The offset index is a plain text file with a line for every record written, consisting of the WARC-Record-ID
+// without the surrounding '<' and '>', the offset and the length of the record separated by a TAB. Records with
+// WARC-Concurrent-To fields get the concurrent ids as a fourth field, see [OffsetIndexResolver.ResolveConcurrent].
+// The index file gets the name of the WARC file with the extension replaced by .idx, e.g. foo.warc.gz is indexed in
+// foo.idx. Like the file written by [WithCdxFile], it has the open file suffix while being written and is finalized
+// just before the WARC file.
+//
+// defaults to false
+func WithOffsetIndexSidecar(idxFile bool) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.idxFile = idxFile
+	})
+}
+
+// WithOffsetTable sets if writer should write a table of the offsets of all records as the last record of each WARC
+// file.
+//
+// The table is written to a metadata record with Content-Type set to [ApplicationOffsetTable] when the file is closed.
+// The block is a JSON object with the WARC-Record-ID, offset and length of each record. Use [ReadOffsetTable] to read
+// the table without scanning the file. The size of the table is not taken into account by [WithMaxFileSize].
+//
+// defaults to false
+func WithOffsetTable(offsetTable bool) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.offsetTable = offsetTable
+	})
+}
+
+// WithRewriteWarcFilename sets if the WARC-Filename field of warcinfo records written should be set to the name of
+// the file they are written to.
+//
+// This is useful when copying records from other WARC files, e.g. when merging files, where the warcinfo records
+// would otherwise reference the original file names. Since WARC-Filename is a header field, the content block and
+// thereby Content-Length and WARC-Block-Digest are not affected.
+//
+// defaults to false
+func WithRewriteWarcFilename(rewrite bool) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.rewriteWarcFilename = rewrite
+	})
+}
+
 // WithCompression sets if writer should write gzip compressed WARC files.
 //
 // defaults to true
@@ -656,6 +1659,22 @@ func WithCompression(compress bool) WarcFileWriterOption {
 	})
 }
 
+// WithSingleStreamCompression sets if writer should compress each WARC file as one gzip stream instead of compressing
+// each record as a separate gzip member. This only has an effect if compression is enabled with [WithCompression].
+//
+// A single stream usually compresses better since the compressor can take advantage of similarities between records,
+// but random access by offset is unavailable for such files: a record can only be reached by decompressing the file
+// from the start. Read the file with [WithSingleStreamDecompression]. The offsets in [WriteResponse], CDX and offset
+// index files are counted in the decompressed stream, and [WithOffsetTable] is ignored. Since the compressor buffers
+// data, the file size checked against [WithMaxFileSize] lags behind what is written, making the limit approximate.
+//
+// defaults to false
+func WithSingleStreamCompression(singleStream bool) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.singleStreamCompression = singleStream
+	})
+}
+
 // WithCompressionLevel sets the gzip level (1-9) to use for compression.
 //
 // defaults to 5
@@ -740,7 +1759,8 @@ func WithMaxConcurrentWriters(count int) WarcFileWriterOption {
 //
 // This value is used to decide if a record will fit into a Warcfile's MaxFileSize when using compression
 // since it's not possible to know this before the record is written. If the value is far from the actual size reduction,
-// an under- or overfilled file might be the result.
+// an under- or overfilled file might be the result. The value is only used until the first file is finished, after that
+// the measured ratio is used, see [WarcFileWriter.CompressionRatio].
 //
 // defaults to .5 (half the uncompressed size)
 func WithExpectedCompressionRatio(ratio float64) WarcFileWriterOption {
@@ -776,6 +1796,23 @@ func WithAddWarcConcurrentToHeader(addConcurrentHeader bool) WarcFileWriterOptio
 	})
 }
 
+// WithRecordTransformer adds a function which is applied to every record passed to [WarcFileWriter.Write] before it is
+// written, e.g. for redacting header fields.
+//
+// The transformer might modify the record and return it, or return another record which is then written in its place.
+// A record which changes the block should be made with a [WarcRecordBuilder], so that Content-Length and digests match
+// the new block. Records made by a transformer are closed by the writer, the record passed to Write is still owned by
+// the caller. If the transformer returns an error, the record is not written and the error is returned in the
+// WriteResponse.
+//
+// The transformers are applied in the order they are added. Warcinfo records made by the writer itself are not
+// transformed.
+func WithRecordTransformer(transformer func(record WarcRecord) (WarcRecord, error)) WarcFileWriterOption {
+	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
+		o.recordTransformers = append(o.recordTransformers, transformer)
+	})
+}
+
 // WithRecordOptions sets the options to use for creating WarcInfo records.
 //
 // See WithWarcInfoFunc
@@ -797,6 +1834,11 @@ func WithBeforeFileCreationHook(f func(fileName string) error) WarcFileWriterOpt
 // WithAfterFileCreationHook sets a function to be called after a new file is created.
 //
 // The function receives the file name of the new file, the size of the file and the WARC-Warcinfo-ID.
+//
+// The function is called when the file is finished, i.e. synced, closed and renamed to its final name. This happens
+// on rollover, [WarcFileWriter.Rotate] and [WarcFileWriter.Close]. The function can be used to notify an indexer
+// directly instead of watching the file system, e.g. by sending the file name on a channel. Writes to the file's writer
+// are blocked while the function runs, so it should return quickly. The returned error is ignored.
 func WithAfterFileCreationHook(f func(fileName string, size int64, warcInfoId string) error) WarcFileWriterOption {
 	return newFuncWarcFileOption(func(o *warcFileWriterOptions) {
 		o.afterFileCreationHook = f
@@ -17,10 +17,19 @@
 package gowarc
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -34,7 +43,7 @@ const (
 )
 
 func TestWarcFileWriter_Write_uncompressed(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -47,6 +56,7 @@ func TestWarcFileWriter_Write_uncompressed(t *testing.T) {
 
 	assert.NoError(os.Mkdir(testdir, 0755))
 	w := NewWarcFileWriter(
+		WithClock(clock),
 		WithCompression(false),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(0),
@@ -71,7 +81,7 @@ func TestWarcFileWriter_Write_uncompressed(t *testing.T) {
 }
 
 func TestWarcFileWriter_Write_compressed(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -84,6 +94,7 @@ func TestWarcFileWriter_Write_compressed(t *testing.T) {
 
 	assert.NoError(os.Mkdir(testdir, 0755))
 	w := NewWarcFileWriter(
+		WithClock(clock),
 		WithCompression(true),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(0),
@@ -108,7 +119,7 @@ func TestWarcFileWriter_Write_compressed(t *testing.T) {
 }
 
 func TestWarcFileWriter_Write_warcinfo_uncompressed(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -121,6 +132,7 @@ func TestWarcFileWriter_Write_warcinfo_uncompressed(t *testing.T) {
 
 	assert.NoError(os.Mkdir(testdir, 0755))
 	w := NewWarcFileWriter(
+		WithClock(clock),
 		WithCompression(false),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(0),
@@ -151,7 +163,7 @@ func TestWarcFileWriter_Write_warcinfo_uncompressed(t *testing.T) {
 }
 
 func TestWarcFileWriter_Write_warcinfo_compressed(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -164,6 +176,7 @@ func TestWarcFileWriter_Write_warcinfo_compressed(t *testing.T) {
 
 	assert.NoError(os.Mkdir(testdir, 0755))
 	w := NewWarcFileWriter(
+		WithClock(clock),
 		WithCompression(true),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(0),
@@ -194,7 +207,7 @@ func TestWarcFileWriter_Write_warcinfo_compressed(t *testing.T) {
 }
 
 func TestWarcFileWriter_Write_multi(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -207,6 +220,7 @@ func TestWarcFileWriter_Write_multi(t *testing.T) {
 
 	assert.NoError(os.Mkdir(testdir, 0755))
 	w := NewWarcFileWriter(
+		WithClock(clock),
 		WithCompression(false),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(0),
@@ -235,7 +249,7 @@ func TestWarcFileWriter_Write_multi(t *testing.T) {
 }
 
 func TestWarcFileWriter_Write_multi_with_crossreference(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -248,6 +262,7 @@ func TestWarcFileWriter_Write_multi_with_crossreference(t *testing.T) {
 
 	assert.NoError(os.Mkdir(testdir, 0755))
 	w := NewWarcFileWriter(
+		WithClock(clock),
 		WithCompression(false),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(0),
@@ -297,7 +312,7 @@ func TestWarcFileWriter_Write_multi_with_crossreference(t *testing.T) {
 }
 
 func TestWarcFileWriter_Write(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -456,6 +471,7 @@ func TestWarcFileWriter_Write(t *testing.T) {
 
 			assert.NoError(os.Mkdir(testdir, 0755))
 			w := NewWarcFileWriter(
+				WithClock(clock),
 				WithCompression(tt.args.compress),
 				WithFileNameGenerator(nameGenerator),
 				WithMaxFileSize(tt.args.maxFileSize),
@@ -565,7 +581,7 @@ func fileCount(assert *assert.Assertions, directory string, expected []int) {
 }
 
 func TestDefaultNameGenerator_NewWarcfileName(t *testing.T) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -585,6 +601,7 @@ func TestDefaultNameGenerator_NewWarcfileName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			tt.generator.Clock = clock
 			for i := 0; i < tt.invocations; i++ {
 				gotDir, gotName := tt.generator.NewWarcfileName()
 				assert.Regexp(t, tt.wantDir, gotDir)
@@ -594,10 +611,127 @@ func TestDefaultNameGenerator_NewWarcfileName(t *testing.T) {
 	}
 }
 
+func TestPatternNameGenerator_NewWarcfileName_concurrent(t *testing.T) {
+	g := &PatternNameGenerator{}
+	names := make(chan string, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, name := g.NewWarcfileName()
+				names <- name
+			}
+		}()
+	}
+	wg.Wait()
+	close(names)
+
+	serials := make(map[string]bool)
+	for name := range names {
+		assert.Regexp(t, "^\\d{14}-\\d{4}-.*\\.warc$", name)
+		serials[strings.Split(name, "-")[1]] = true
+	}
+	assert.Len(t, serials, 100)
+}
+
+func TestNewPatternNameGenerator(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{"", ""},
+		{defaultPattern, ""},
+		{"100%%-%{prefix}s%{ts}s-%05{serial}d-%{ip}s-%{host}s.%{ext}s", ""},
+		{"%{prefix}s%{seral}d.warc", "unknown name 'seral'"},
+		{"%{serial}s.warc", "verb '%s' not allowed for 'serial'"},
+		{"%d.warc", "missing parameter name in verb at position 0"},
+		{"%{serial.warc", "unterminated parameter name"},
+		{"file-%{serial}", "missing verb for parameter 'serial'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			g, err := NewPatternNameGenerator(PatternNameGenerator{Directory: "dir", Pattern: tt.pattern})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			dir, name := g.NewWarcfileName()
+			assert.Equal(t, "dir", dir)
+			assert.NotContains(t, name, "%!")
+		})
+	}
+}
+
+func TestPatternNameGenerator_NewWarcfileNameForWriter(t *testing.T) {
+	g := &PatternNameGenerator{Pattern: "test-w%02{writer}d-%04{serial}d.warc", Serial: 10, SerialPerWriter: true}
+	var names []string
+	for _, writer := range []int{0, 1, 0, 1, 1} {
+		_, name := g.NewWarcfileNameForWriter(writer)
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{
+		"test-w00-0011.warc", "test-w01-0011.warc", "test-w00-0012.warc", "test-w01-0012.warc", "test-w01-0013.warc",
+	}, names)
+
+	// Without SerialPerWriter the serial is shared
+	g = &PatternNameGenerator{Pattern: "test-w%02{writer}d-%04{serial}d.warc"}
+	_, name := g.NewWarcfileNameForWriter(1)
+	assert.Equal(t, "test-w01-0001.warc", name)
+	_, name = g.NewWarcfileName()
+	assert.Equal(t, "test-w00-0002.warc", name)
+
+	// Without the writer name in the pattern the serial is shared to keep the names unique
+	g = &PatternNameGenerator{Pattern: "test-%04{serial}d.warc", SerialPerWriter: true}
+	_, name = g.NewWarcfileNameForWriter(1)
+	assert.Equal(t, "test-0001.warc", name)
+	_, name = g.NewWarcfileNameForWriter(0)
+	assert.Equal(t, "test-0002.warc", name)
+
+	_, err := NewPatternNameGenerator(PatternNameGenerator{SerialPerWriter: true})
+	assert.ErrorContains(t, err, "SerialPerWriter requires the name 'writer'")
+	_, err = NewPatternNameGenerator(PatternNameGenerator{Pattern: "test-w%02{writer}d-%04{serial}d.warc", SerialPerWriter: true})
+	assert.NoError(t, err)
+}
+
+func TestWarcFileWriter_WriterWarcFileNameGenerator(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithMaxFileSize(1),
+		WithMaxConcurrentWriters(2),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-w%02{writer}d-%04{serial}d.warc", SerialPerWriter: true}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := w.Write(createTestRecord())
+			assert.NoError(t, res[0].Err)
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, w.Close())
+
+	// The files of each writer are numbered sequentially without gaps
+	serials := make(map[string]int)
+	for _, name := range m.Names() {
+		require.Regexp(t, "^test-w0[01]-\\d{4}\\.warc$", name)
+		writer := name[:len("test-w00")]
+		serials[writer]++
+		assert.Equal(t, fmt.Sprintf("%s-%04d.warc", writer, serials[writer]), name)
+	}
+	assert.Len(t, m.Names(), 10)
+}
+
 var warcFileWriterBenchmarkResult interface{}
 
 func BenchmarkWarcFileWriter_Write_compressed(b *testing.B) {
-	now = func() time.Time {
+	clock := func() time.Time {
 		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
 	}
 	hostOrIp = func() string {
@@ -610,6 +744,7 @@ func BenchmarkWarcFileWriter_Write_compressed(b *testing.B) {
 	nameGenerator := &PatternNameGenerator{Prefix: "bench-", Directory: testdir}
 	assert.NoError(os.Mkdir(testdir, 0755))
 	w := NewWarcFileWriter(
+		WithClock(clock),
 		WithCompression(true),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(0),
@@ -622,3 +757,981 @@ func BenchmarkWarcFileWriter_Write_compressed(b *testing.B) {
 		warcFileWriterBenchmarkResult = res
 	}
 }
+
+func BenchmarkWarcFileWriter_Write_MemFileSystem(b *testing.B) {
+	clock := func() time.Time {
+		return time.Date(2001, 9, 12, 5, 30, 20, 0, time.UTC)
+	}
+	hostOrIp = func() string {
+		return "example"
+	}
+
+	assert := assert.New(b)
+
+	nameGenerator := &PatternNameGenerator{Prefix: "bench-"}
+	w := NewWarcFileWriter(
+		WithClock(clock),
+		WithFileSystem(NewMemFileSystem()),
+		WithCompression(true),
+		WithFileNameGenerator(nameGenerator),
+		WithMaxFileSize(0),
+		WithMaxConcurrentWriters(1))
+	defer func() { assert.NoError(w.Close()) }()
+
+	for n := 0; n < b.N; n++ {
+		res := w.Write(createTestRecord())
+		warcFileWriterBenchmarkResult = res
+	}
+}
+
+var warcFileReaderBenchmarkResult interface{}
+
+// BenchmarkWarcFileReader_Next reads a small file for each iteration, like an indexer reading many files.
+func BenchmarkWarcFileReader_Next(b *testing.B) {
+	data := &bytes.Buffer{}
+	m := NewMarshaler()
+	for i := 0; i < 10; i++ {
+		_, _, err := m.Marshal(data, createTestRecord(), 0)
+		require.NoError(b, err)
+	}
+
+	benchmarks := []struct {
+		name string
+		opts []WarcRecordOption
+	}{
+		{"default", nil},
+		{"unpooled", []WarcRecordOption{WithReadBufferSize(64 * 1024)}},
+		{"pooled", []WarcRecordOption{WithReadBufferPool(NewReadBufferPool(64 * 1024))}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				wf, err := NewWarcFileReaderFromStream(bytes.NewReader(data.Bytes()), 0, bm.opts...)
+				require.NoError(b, err)
+				for {
+					record, _, _, err := wf.Next()
+					if err != nil {
+						warcFileReaderBenchmarkResult = err
+						break
+					}
+					warcFileReaderBenchmarkResult = record.Close()
+				}
+				_ = wf.Close()
+			}
+		})
+	}
+}
+
+func TestNewWarcFileReaderFromStream_pipe(t *testing.T) {
+	assert := assert.New(t)
+
+	pr, pw, err := os.Pipe()
+	assert.NoError(err)
+	go func() {
+		_, _, _ = NewMarshaler().Marshal(pw, createTestRecord(), 0)
+		_, _, _ = NewMarshaler().Marshal(pw, createTestRecord(), 0)
+		_ = pw.Close()
+	}()
+
+	r, err := NewWarcFileReaderFromStream(pr, 0)
+	assert.NoError(err)
+	defer func() { assert.NoError(r.Close()) }()
+
+	for _, wantOffset := range []int64{0, uncompressedRecordSize} {
+		record, offset, _, err := r.Next()
+		assert.NoError(err)
+		assert.Equal(wantOffset, offset)
+		assert.NoError(record.Close())
+	}
+	_, offset, _, err := r.Next()
+	assert.ErrorIs(err, io.EOF)
+	assert.Equal(2*uncompressedRecordSize, offset)
+}
+
+func TestWarcFileReader_progressFunc(t *testing.T) {
+	assert := assert.New(t)
+	filename := writeTestFile(t, t.TempDir(), createTestRecord(), createTestRecord(), createTestRecord())
+
+	type progress struct{ bytesRead, fileSize, records int64 }
+	var got []progress
+	r, err := NewWarcFileReader(filename, 0, WithProgressFunc(func(bytesRead, fileSize, records int64) {
+		got = append(got, progress{bytesRead, fileSize, records})
+	}))
+	assert.NoError(err)
+	defer func() { assert.NoError(r.Close()) }()
+
+	for {
+		record, _, _, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		assert.NoError(record.Close())
+	}
+
+	assert.Equal([]progress{
+		{uncompressedRecordSize, 3 * uncompressedRecordSize, 1},
+		{2 * uncompressedRecordSize, 3 * uncompressedRecordSize, 2},
+		{3 * uncompressedRecordSize, 3 * uncompressedRecordSize, 3},
+	}, got)
+}
+
+func TestWarcFileReader_WithDateRange(t *testing.T) {
+	dates := []string{"2006-01-01T23:59:59Z", "2006-01-02T00:00:00Z", "2006-01-02T12:00:00.123456Z", "2006-01-03T00:00:00Z"}
+	var records []WarcRecord
+	for _, date := range dates {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcDate, date)
+		records = append(records, record)
+	}
+	filename := writeTestFile(t, t.TempDir(), records...)
+
+	day := time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		from, to    time.Time
+		wantDates   []string
+		wantOffsets []int64
+	}{
+		{"one day", day, day.AddDate(0, 0, 1), dates[1:3], []int64{uncompressedRecordSize, 2 * uncompressedRecordSize}},
+		{"open start", time.Time{}, day, dates[:1], []int64{0}},
+		{"open end", day.Add(time.Hour), time.Time{}, dates[2:], []int64{2 * uncompressedRecordSize, 3*uncompressedRecordSize + 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewWarcFileReader(filename, 0, WithDateRange(tt.from, tt.to))
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, r.Close()) }()
+
+			var gotDates []string
+			var gotOffsets []int64
+			for {
+				record, offset, validation, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				assert.True(t, validation.Valid(), validation.String())
+				gotDates = append(gotDates, record.WarcHeader().Get(WarcDate))
+				gotOffsets = append(gotOffsets, offset)
+				assert.NoError(t, record.Close())
+			}
+			assert.Equal(t, tt.wantDates, gotDates)
+			assert.Equal(t, tt.wantOffsets, gotOffsets)
+		})
+	}
+}
+
+func TestWarcFileReader_WithReadBufferSize(t *testing.T) {
+	filename := writeTestFile(t, t.TempDir(), createTestRecord(), createTestRecord())
+
+	for _, size := range []int{0, 64, 64 * 1024} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			r, err := NewWarcFileReader(filename, 0, WithReadBufferSize(size))
+			require.NoError(t, err)
+			if size > 0 {
+				assert.Equal(t, size, r.bufferedReader.Size())
+			} else {
+				assert.Equal(t, defaultReadBufferSize, r.bufferedReader.Size())
+			}
+
+			for _, wantOffset := range []int64{0, uncompressedRecordSize} {
+				record, offset, validation, err := r.Next()
+				require.NoError(t, err)
+				assert.Equal(t, wantOffset, offset)
+				assert.True(t, validation.Valid(), validation.String())
+				assert.NoError(t, record.Close())
+			}
+			_, _, _, err = r.Next()
+			assert.Equal(t, io.EOF, err)
+			assert.NoError(t, r.Close())
+		})
+	}
+}
+
+func TestWarcFileReader_WithReadBufferPool(t *testing.T) {
+	filename := writeTestFile(t, t.TempDir(), createTestRecord(), createTestRecord())
+	pool := NewReadBufferPool(64 * 1024)
+
+	for i := 0; i < 2; i++ {
+		r, err := NewWarcFileReader(filename, 0, WithReadBufferPool(pool), WithReadBufferSize(64))
+		require.NoError(t, err)
+		assert.Equal(t, 64*1024, r.bufferedReader.Size())
+
+		for _, wantOffset := range []int64{0, uncompressedRecordSize} {
+			record, offset, validation, err := r.Next()
+			require.NoError(t, err)
+			assert.Equal(t, wantOffset, offset)
+			assert.True(t, validation.Valid(), validation.String())
+			assert.NoError(t, record.Close())
+		}
+		_, _, _, err = r.Next()
+		assert.Equal(t, io.EOF, err)
+		assert.NoError(t, r.Close())
+		assert.Nil(t, r.bufferPool, "buffer must only be returned to the pool once")
+	}
+}
+
+func TestWarcFileReader_WithFailFast(t *testing.T) {
+	record := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"content\r\n"
+	// The second record is only followed by a single line ending
+	data := record + "\r\n" + record + record + "\r\n"
+
+	t.Run("without", func(t *testing.T) {
+		r, err := NewWarcFileReaderFromStream(strings.NewReader(data), 0)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, r.Close()) }()
+
+		for i := 0; i < 3; i++ {
+			record, _, _, err := r.Next()
+			require.NoError(t, err)
+			assert.NoError(t, record.Close())
+		}
+	})
+
+	t.Run("with", func(t *testing.T) {
+		r, err := NewWarcFileReaderFromStream(strings.NewReader(data), 0, WithFailFast())
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, r.Close()) }()
+
+		rec, offset, validation, err := r.Next()
+		require.NoError(t, err)
+		assert.True(t, validation.Valid(), validation.String())
+		assert.NoError(t, rec.Close())
+
+		rec, offset, validation, err = r.Next()
+		require.Error(t, err)
+		assert.Equal(t, int64(len(record)+2), offset)
+		var v *Validation
+		require.ErrorAs(t, err, &v)
+		assert.Equal(t, validation, v)
+		assert.ErrorContains(t, err, "missing line ending in end of record marker")
+		require.NotNil(t, rec)
+		assert.NoError(t, rec.Close())
+	})
+
+	t.Run("with date range", func(t *testing.T) {
+		// The invalid record is outside the date range and is skipped without failing
+		skipped := strings.Replace(record, "WARC-Date: 2017-03-06T04:03:53Z\r\n",
+			"WARC-Date: 2005-03-06T04:03:53Z\r\nWARC-IP-Address: not-an-ip\r\n", 1)
+		r, err := NewWarcFileReaderFromStream(strings.NewReader(skipped+"\r\n"+record+"\r\n"), 0, WithFailFast(),
+			WithDateRange(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}))
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, r.Close()) }()
+
+		rec, offset, validation, err := r.Next()
+		require.NoError(t, err)
+		assert.True(t, validation.Valid(), validation.String())
+		assert.Equal(t, int64(len(skipped)+2), offset)
+		assert.NoError(t, rec.Close())
+
+		_, _, _, err = r.Next()
+		assert.Equal(t, io.EOF, err)
+	})
+}
+
+func TestWarcFileReader_unexpectedEOF(t *testing.T) {
+	record := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"content\r\n\r\n"
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"end of file", record, io.EOF},
+		{"extra line endings", record + "\r\n\n", io.EOF},
+		{"truncated magic", record + "WAR", ErrUnexpectedEOF},
+		{"truncated version line", record + "WARC/1.1", ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewWarcFileReaderFromStream(strings.NewReader(tt.data), 0)
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, r.Close()) }()
+
+			rec, _, _, err := r.Next()
+			require.NoError(t, err)
+			assert.NoError(t, rec.Close())
+
+			_, offset, _, err := r.Next()
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, int64(len(record)), offset)
+			if tt.wantErr == ErrUnexpectedEOF {
+				assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+				assert.EqualError(t, err, fmt.Sprintf("gowarc: unexpected EOF in record at offset %d", len(record)))
+			}
+		})
+	}
+}
+
+func TestWarcFileReader_LastRecordSize(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dir := t.TempDir()
+			w := NewWarcFileWriter(
+				WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test.warc"}),
+				WithCompression(compress),
+				WithMaxFileSize(0))
+			res := w.Write(createTestRecord())
+			require.NoError(t, res[0].Err)
+			res = w.Write(createTestRecord())
+			require.NoError(t, res[0].Err)
+			require.NoError(t, w.Close())
+			filename := filepath.Join(dir, res[0].FileName)
+			fi, err := os.Stat(filename)
+			require.NoError(t, err)
+
+			r, err := NewWarcFileReader(filename, 0)
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, r.Close()) }()
+
+			var offsets []int64
+			var sizes []int64
+			for {
+				record, offset, _, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				size, uncompressedSize := r.LastRecordSize()
+				assert.Equal(t, int64(uncompressedRecordSize), uncompressedSize)
+				if !compress {
+					assert.Equal(t, int64(uncompressedRecordSize), size)
+				}
+				offsets = append(offsets, offset)
+				sizes = append(sizes, size)
+				assert.NoError(t, record.Close())
+			}
+			require.Len(t, offsets, 2)
+			assert.Equal(t, offsets[1], offsets[0]+sizes[0])
+			assert.Equal(t, fi.Size(), offsets[1]+sizes[1])
+
+			size, uncompressedSize := r.LastRecordSize()
+			assert.Zero(t, size)
+			assert.Zero(t, uncompressedSize)
+		})
+	}
+}
+
+func TestWarcFileReader_offsetPast4GB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test with large sparse file in short mode")
+	}
+	const recordOffset = int64(5) << 30
+
+	// Create a sparse file with records beyond the 4 GiB boundary
+	buf := &bytes.Buffer{}
+	marshaler := NewMarshaler()
+	for i := 0; i < 2; i++ {
+		_, _, err := marshaler.Marshal(buf, createTestRecord(), 0)
+		require.NoError(t, err)
+	}
+	filename := t.TempDir() + "/large.warc"
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	_, err = f.WriteAt(buf.Bytes(), recordOffset)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	r, err := NewWarcFileReader(filename, recordOffset)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	for _, want := range []int64{recordOffset, recordOffset + uncompressedRecordSize} {
+		record, offset, validation, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want, offset)
+		assert.True(t, validation.Valid(), validation.String())
+		assert.NoError(t, record.Close())
+	}
+	_, offset, _, err := r.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, recordOffset+2*uncompressedRecordSize, offset)
+
+	// Read the second record back by its offset
+	r2, err := NewWarcFileReader(filename, recordOffset+uncompressedRecordSize)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r2.Close()) }()
+	record, offset, _, err := r2.Next()
+	require.NoError(t, err)
+	assert.Equal(t, recordOffset+uncompressedRecordSize, offset)
+	assert.Equal(t, "urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008", record.RecordId())
+	assert.NoError(t, record.Close())
+}
+
+func TestWarcFileWriter_WithRewriteWarcFilename(t *testing.T) {
+	rb := NewRecordBuilder(Warcinfo)
+	rb.AddWarcHeader(WarcDate, "2006-01-02T15:04:05Z")
+	rb.AddWarcHeader(WarcFilename, "original.warc.gz")
+	rb.AddWarcHeader(ContentType, ApplicationWarcFields)
+	_, err := rb.WriteString("software: test\r\n")
+	require.NoError(t, err)
+	warcinfo, _, err := rb.Build()
+	require.NoError(t, err)
+
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "merged-%04{serial}d.warc"}),
+		WithRewriteWarcFilename(true))
+	res := w.Write(warcinfo)
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+
+	b, err := m.ReadFile("merged-0001.warc.gz")
+	require.NoError(t, err)
+	r, err := NewWarcFileReaderFromStream(bytes.NewReader(b), 0, WithStrictValidation())
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+	record, _, validation, err := r.Next()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+	assert.True(t, validation.Valid(), validation.String())
+	assert.Equal(t, "merged-0001.warc.gz", record.WarcHeader().Get(WarcFilename))
+}
+
+func TestWarcFileWriter_WriteWarcInfo(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}))
+
+	// No file is open, so nothing is written
+	assert.Empty(t, w.WriteWarcInfo(&WarcFields{}))
+
+	res := w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+
+	fields := &WarcFields{}
+	fields.Add("software", "test")
+	fields.Add("description", "new configuration")
+	res = w.WriteWarcInfo(fields)
+	require.Len(t, res, 1)
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, "test-0001.warc", res[0].FileName)
+	warcInfoOffset := res[0].FileOffset
+
+	res = w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+
+	b, err := m.ReadFile("test-0001.warc")
+	require.NoError(t, err)
+	r, err := NewWarcFileReaderFromStream(bytes.NewReader(b), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	var warcInfoIds []string
+	for i := 0; i < 4; i++ {
+		record, offset, validation, err := r.Next()
+		require.NoError(t, err)
+		assert.True(t, validation.Valid(), validation.String())
+		switch i {
+		case 0:
+			assert.Equal(t, Warcinfo, record.Type())
+			warcInfoIds = append(warcInfoIds, record.WarcHeader().Get(WarcRecordID))
+		case 2:
+			assert.Equal(t, Warcinfo, record.Type())
+			assert.Equal(t, warcInfoOffset, offset)
+			assert.Equal(t, "test-0001.warc", record.WarcHeader().Get(WarcFilename))
+			assert.False(t, record.WarcHeader().Has(WarcWarcinfoID))
+			wb := record.Block().(WarcFieldsBlock)
+			assert.Equal(t, "new configuration", wb.WarcFields().Get("description"))
+			warcInfoIds = append(warcInfoIds, record.WarcHeader().Get(WarcRecordID))
+		default:
+			assert.Equal(t, Response, record.Type())
+			assert.Equal(t, warcInfoIds[len(warcInfoIds)-1], record.WarcHeader().Get(WarcWarcinfoID))
+		}
+		assert.NoError(t, record.Close())
+	}
+	assert.NotEqual(t, warcInfoIds[0], warcInfoIds[1])
+}
+
+func TestWarcFileWriter_RotateFiles(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}))
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	res := w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+
+	files, err := w.RotateFiles()
+	require.NoError(t, err)
+	assert.Equal(t, []FinishedFile{{Name: "test-0001.warc", Size: uncompressedRecordSize, UncompressedSize: uncompressedRecordSize}}, files)
+	assert.Equal(t, []string{"test-0001.warc"}, m.Names())
+
+	// Nothing is written since last rotation
+	files, err = w.RotateFiles()
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	res = w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, "test-0002.warc", res[0].FileName)
+}
+
+func TestWarcFileWriter_WithMaxRecordsPerFile(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithMaxRecordsPerFile(2),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+			rb.AddWarcHeader(ContentType, ApplicationWarcFields)
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}))
+
+	var fileNames []string
+	for i := 0; i < 5; i++ {
+		res := w.Write(createTestRecord())
+		require.NoError(t, res[0].Err)
+		fileNames = append(fileNames, res[0].FileName)
+	}
+	assert.Equal(t, []string{"test-0001.warc", "test-0001.warc", "test-0002.warc", "test-0002.warc", "test-0003.warc"}, fileNames)
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"test-0001.warc", "test-0002.warc", "test-0003.warc"}, m.Names())
+}
+
+func TestWarcFileWriter_WithMaxFileAge(t *testing.T) {
+	t.Run("checked on write", func(t *testing.T) {
+		start := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		current := start
+		m := NewMemFileSystem()
+		w := NewWarcFileWriter(
+			WithClock(func() time.Time { return current }),
+			WithFileSystem(m),
+			WithCompression(false),
+			WithMaxFileAge(time.Hour),
+			WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}))
+		defer func() { assert.NoError(t, w.Close()) }()
+
+		var fileNames []string
+		for _, d := range []time.Duration{0, 59 * time.Minute, time.Hour} {
+			current = start.Add(d)
+			res := w.Write(createTestRecord())
+			require.NoError(t, res[0].Err)
+			fileNames = append(fileNames, res[0].FileName)
+		}
+		assert.Equal(t, []string{"test-0001.warc", "test-0001.warc", "test-0002.warc"}, fileNames)
+		assert.Equal(t, []string{"test-0001.warc", "test-0002.warc.open"}, m.Names())
+	})
+
+	t.Run("idle writer", func(t *testing.T) {
+		m := NewMemFileSystem()
+		closed := make(chan string, 1)
+		w := NewWarcFileWriter(
+			WithFileSystem(m),
+			WithCompression(false),
+			WithMaxFileAge(50*time.Millisecond),
+			WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+			WithAfterFileCreationHook(func(fileName string, size int64, warcInfoId string) error {
+				closed <- fileName
+				return nil
+			}))
+		defer func() { assert.NoError(t, w.Close()) }()
+
+		res := w.Write(createTestRecord())
+		require.NoError(t, res[0].Err)
+
+		select {
+		case fileName := <-closed:
+			assert.Equal(t, "test-0001.warc", fileName)
+		case <-time.After(5 * time.Second):
+			t.Fatal("file was not closed when reaching max age")
+		}
+		assert.Equal(t, []string{"test-0001.warc"}, m.Names())
+	})
+}
+
+func TestWarcFileWriter_WithIdleTimeout(t *testing.T) {
+	m := NewMemFileSystem()
+	closed := make(chan string, 2)
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithIdleTimeout(100*time.Millisecond),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithAfterFileCreationHook(func(fileName string, size int64, warcInfoId string) error {
+			closed <- fileName
+			return nil
+		}))
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		res := w.Write(createTestRecord())
+		require.NoError(t, res[0].Err)
+		assert.Equal(t, "test-0001.warc", res[0].FileName)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case fileName := <-closed:
+		assert.Equal(t, "test-0001.warc", fileName)
+		assert.GreaterOrEqual(t, time.Since(start), 110*time.Millisecond, "file closed before idle timeout after last write")
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle file was not closed")
+	}
+	assert.Equal(t, []string{"test-0001.warc"}, m.Names())
+
+	// The next write opens a new file
+	res := w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, "test-0002.warc", res[0].FileName)
+}
+
+func TestWarcFileWriter_WithIdleTimeout_clock(t *testing.T) {
+	current := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return current
+	}
+	m := NewMemFileSystem()
+	closed := make(chan string, 1)
+	generator := &PatternNameGenerator{Pattern: "test-%{ts}s-%04{serial}d.warc"}
+	w := NewWarcFileWriter(
+		WithClock(clock),
+		WithFileSystem(m),
+		WithCompression(false),
+		WithIdleTimeout(20*time.Millisecond),
+		WithFileNameGenerator(generator),
+		WithAfterFileCreationHook(func(fileName string, size int64, warcInfoId string) error {
+			closed <- fileName
+			return nil
+		}))
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	res := w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, "test-20060102150405-0001.warc", res[0].FileName)
+	assert.Nil(t, generator.Clock, "writer must not set the clock of the name generator")
+
+	// The clock hasn't advanced, so the file is not idle
+	select {
+	case fileName := <-closed:
+		t.Fatalf("file %s closed while the clock was stopped", fileName)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	current = current.Add(time.Second)
+	mu.Unlock()
+	select {
+	case fileName := <-closed:
+		assert.Equal(t, "test-20060102150405-0001.warc", fileName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle file was not closed")
+	}
+}
+
+func TestWarcFileWriter_CompressionRatio(t *testing.T) {
+	w := NewWarcFileWriter(
+		WithFileSystem(NewMemFileSystem()),
+		WithExpectedCompressionRatio(.5),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}))
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	assert.Equal(t, .5, w.CompressionRatio())
+
+	measured := float64(compressedRecordSize) / float64(uncompressedRecordSize)
+	for i := 0; i < 2; i++ {
+		res := w.Write(createTestRecord(), createTestRecord())
+		require.NoError(t, res[0].Err)
+		require.NoError(t, res[1].Err)
+		files, err := w.RotateFiles()
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, 2*compressedRecordSize, files[0].Size)
+		assert.Equal(t, 2*uncompressedRecordSize, files[0].UncompressedSize)
+
+		// The first measurement replaces the expected ratio, later measurements are averaged in
+		assert.InDelta(t, measured, w.CompressionRatio(), 1e-9)
+	}
+}
+
+func TestWarcFileWriter_reproducible(t *testing.T) {
+	clock := func() time.Time { return time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC) }
+
+	write := func() []byte {
+		m := NewMemFileSystem()
+		w := NewWarcFileWriter(
+			WithClock(clock),
+			WithFileSystem(m),
+			WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%{ts}s-%04{serial}d.warc"}),
+			WithRecordOptions(WithRecordIdFunc(NewDeterministicIdFunc("test"))),
+			WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+				_, err := rb.WriteString("software: test\r\n")
+				return err
+			}))
+		res := w.Write(createTestRecord())
+		require.NoError(t, res[0].Err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, []string{"test-20060102150405-0001.warc.gz"}, m.Names())
+		b, err := m.ReadFile("test-20060102150405-0001.warc.gz")
+		require.NoError(t, err)
+		return b
+	}
+	assert.Equal(t, write(), write())
+}
+
+func TestWarcFileWriter_WithRecordTransformer(t *testing.T) {
+	m := NewMemFileSystem()
+	var calls []string
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Pattern: "test-%04{serial}d.warc"}),
+		WithRecordTransformer(func(record WarcRecord) (WarcRecord, error) {
+			calls = append(calls, "redact")
+			record.WarcHeader().Delete(WarcBlockDigest)
+			return record, nil
+		}),
+		WithRecordTransformer(func(record WarcRecord) (WarcRecord, error) {
+			calls = append(calls, "replace")
+			if record.WarcHeader().Has(WarcBlockDigest) {
+				return nil, fmt.Errorf("transformers applied out of order")
+			}
+			rb := NewRecordBuilder(Resource, WithAddMissingDigest(false))
+			rb.AddWarcHeader(WarcRecordID, record.WarcHeader().Get(WarcRecordID))
+			rb.AddWarcHeader(WarcDate, record.WarcHeader().Get(WarcDate))
+			rb.AddWarcHeader(WarcTargetURI, "http://www.example.com/")
+			rb.AddWarcHeader(ContentType, "text/plain")
+			_, err := rb.WriteString("replaced")
+			if err != nil {
+				return nil, err
+			}
+			r, _, err := rb.Build()
+			return r, err
+		}))
+
+	res := w.Write(createTestRecord())
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"redact", "replace"}, calls)
+
+	b, err := m.ReadFile("test-0001.warc")
+	require.NoError(t, err)
+	record, _, _, err := NewUnmarshaler().Unmarshal(bufio.NewReader(bytes.NewReader(b)))
+	require.NoError(t, err)
+	defer func() { _ = record.Close() }()
+	assert.Equal(t, Resource, record.Type())
+	assert.Equal(t, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>", record.WarcHeader().Get(WarcRecordID))
+	assert.Equal(t, "8", record.WarcHeader().Get(ContentLength))
+	assert.Equal(t, int64(len(b)), res[0].BytesWritten)
+}
+
+func TestWarcFileWriter_WithRecordTransformer_error(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithRecordTransformer(func(record WarcRecord) (WarcRecord, error) {
+			if record.WarcHeader().Get(WarcTargetURI) == "" {
+				return nil, fmt.Errorf("missing target uri")
+			}
+			return record, nil
+		}),
+		WithRecordTransformer(func(record WarcRecord) (WarcRecord, error) {
+			return nil, nil
+		}))
+
+	res := w.Write(createTestRecord())
+	assert.EqualError(t, res[0].Err, "missing target uri")
+
+	record := createTestRecord()
+	record.WarcHeader().Set(WarcTargetURI, "http://www.example.com/")
+	res = w.Write(record)
+	assert.Error(t, res[0].Err)
+
+	require.NoError(t, w.Close())
+	assert.Empty(t, m.Names())
+}
+
+func TestWarcFileReader_Stream(t *testing.T) {
+	filename := writeTestFile(t, t.TempDir(), createTestRecord(), createTestRecord(), createTestRecord())
+
+	r, err := NewWarcFileReader(filename, 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	ch, err := r.Stream(context.Background())
+	require.NoError(t, err)
+	var offsets []int64
+	for res := range ch {
+		require.NoError(t, res.Err)
+		assert.True(t, res.Validation.Valid(), res.Validation)
+		assert.Equal(t, Response, res.Record.Type())
+		offsets = append(offsets, res.Offset)
+		assert.NoError(t, res.Record.Close())
+	}
+	assert.Equal(t, []int64{0, uncompressedRecordSize, 2 * uncompressedRecordSize}, offsets)
+}
+
+func TestWarcFileReader_Stream_cancel(t *testing.T) {
+	filename := writeTestFile(t, t.TempDir(), createTestRecord(), createTestRecord())
+
+	r, err := NewWarcFileReader(filename, 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := r.Stream(ctx)
+	require.NoError(t, err)
+	res := <-ch
+	require.NoError(t, res.Err)
+
+	// The next record is not read while the first one is open, so canceling ends the stream
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.NoError(t, res.Record.Close())
+
+	_, err = r.Stream(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWarcFileReader_WithReadLimit(t *testing.T) {
+	filename := writeTestFile(t, t.TempDir(), createTestRecord(), createTestRecord(), createTestRecord())
+
+	for _, tt := range []struct {
+		limit int64
+		want  int
+	}{
+		{0, 3},
+		{1, 1},
+		{uncompressedRecordSize, 1},
+		{uncompressedRecordSize + 1, 2},
+	} {
+		t.Run(strconv.FormatInt(tt.limit, 10), func(t *testing.T) {
+			r, err := NewWarcFileReader(filename, 0, WithReadLimit(tt.limit))
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, r.Close()) }()
+
+			count := 0
+			for {
+				record, _, _, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				count++
+				assert.NoError(t, record.Close())
+			}
+			assert.Equal(t, tt.want, count)
+		})
+	}
+}
+
+func TestWarcFileReader_WithMaxRecords(t *testing.T) {
+	var records []WarcRecord
+	for _, date := range []string{"2005-01-02T15:04:05Z", "2006-01-02T15:04:05Z", "2007-01-02T15:04:05Z", "2008-01-02T15:04:05Z"} {
+		record := createTestRecord()
+		record.WarcHeader().Set(WarcDate, date)
+		records = append(records, record)
+	}
+	filename := writeTestFile(t, t.TempDir(), records...)
+
+	r, err := NewWarcFileReader(filename, 0, WithMaxRecords(2),
+		WithDateRange(time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	var offsets []int64
+	for {
+		record, offset, _, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		offsets = append(offsets, offset)
+		assert.NoError(t, record.Close())
+	}
+	// The record skipped by the date range is not counted
+	assert.Equal(t, []int64{uncompressedRecordSize, 2 * uncompressedRecordSize}, offsets)
+}
+
+func TestWarcFileWriter_WithSingleStreamCompression(t *testing.T) {
+	m := NewMemFileSystem()
+	w := NewWarcFileWriter(
+		WithFileSystem(m),
+		WithFileNameGenerator(&PatternNameGenerator{Directory: "mem", Pattern: "test-%04{serial}d.warc"}),
+		WithSingleStreamCompression(true))
+
+	var offsets []int64
+	for i := 0; i < 3; i++ {
+		res := w.Write(createTestRecord())
+		require.NoError(t, res[0].Err)
+		assert.Equal(t, int64(uncompressedRecordSize), res[0].BytesWritten)
+		offsets = append(offsets, res[0].FileOffset)
+	}
+	require.NoError(t, w.Close())
+	// Offsets are counted in the decompressed stream
+	assert.Equal(t, []int64{0, uncompressedRecordSize, 2 * uncompressedRecordSize}, offsets)
+
+	b, err := m.ReadFile("mem/test-0001.warc.gz")
+	require.NoError(t, err)
+	assert.Less(t, int64(len(b)), 3*compressedRecordSize, "a single stream should compress better than separate members")
+
+	// The file is one gzip member holding all the records
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	gz.Multistream(false)
+	n, err := io.Copy(io.Discard, gz)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3*uncompressedRecordSize), n)
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   []int64
+	}{
+		{"from start", 0, offsets},
+		{"from offset", uncompressedRecordSize, offsets[1:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewWarcFileReaderFromStream(bytes.NewReader(b), tt.offset, WithSingleStreamDecompression())
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, r.Close()) }()
+
+			var got []int64
+			for {
+				record, offset, validation, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				assert.Empty(t, *validation)
+				got = append(got, offset)
+				assert.NoError(t, record.Close())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}